@@ -1,6 +1,7 @@
 package main
 
 import (
+	"path/filepath"
 	"testing"
 
 	"golang.org/x/exp/shiny/materialdesign/colornames"
@@ -15,19 +16,21 @@ func TestPlotTABSDescending(t *testing.T) {
 	p.Title.Text = "TABS Adjustment Algorithms: Constant Numerator vs. Consecutive-Falls Stepping Numerator"
 	p.Legend.Top = true
 
-	tabsAdjustmentDenominator = 4096
+	params := DefaultParams()
+	params.TabsAdjustmentDenominator = 4096
+	sim := NewSimulation(params)
 
 	data := plotter.XYs{}
 	dataStep := plotter.XYs{}
 
-	localTAB := int64(genesisBlockTABS / 2)
+	localTAB := int64(sim.GenesisBlockTABS / 2)
 
-	tabs := genesisBlockTABS
-	tabsStep := genesisBlockTABS
+	tabs := sim.GenesisBlockTABS
+	tabsStep := sim.GenesisBlockTABS
 
 	sequentialFalls := int64(0)
 	for i := int64(1); i <= 4*60*24; i++ {
-		tabs = getTABS(tabs, localTAB)
+		tabs = sim.getTABS(tabs, localTAB)
 		data = append(data, plotter.XY{X: float64(i), Y: float64(tabs)})
 
 		if localTAB >= tabsStep {
@@ -35,7 +38,7 @@ func TestPlotTABSDescending(t *testing.T) {
 		} else {
 			sequentialFalls++
 		}
-		tabsStep = getTABS_step(tabsStep, sequentialFalls, localTAB)
+		tabsStep = sim.getTABS_step(tabsStep, sequentialFalls, localTAB)
 		dataStep = append(dataStep, plotter.XY{X: float64(i), Y: float64(tabsStep)})
 	}
 
@@ -53,7 +56,7 @@ func TestPlotTABSDescending(t *testing.T) {
 	p.Add(scatterStep)
 	p.Legend.Add("TABS_step", scatterStep)
 
-	if err := p.Save(800, 600, "tabs_desc.png"); err != nil {
+	if err := p.Save(800, 600, filepath.Join(t.TempDir(), "tabs_desc.png")); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -63,20 +66,22 @@ func TestPlotConsensusScore(t *testing.T) {
 	p.Title.Text = "TDTABS Adjustment Algorithm Experiment: 51% Stake Attack, < 50% Miner Attack"
 	p.Legend.Top = true
 
-	tabsAdjustmentDenominator = 4096
+	params := DefaultParams()
+	params.TabsAdjustmentDenominator = 4096
+	sim := NewSimulation(params)
 
 	data := plotter.XYs{}
 	dataStep := plotter.XYs{}
 
-	localTAB := int64(genesisBlockTABS * 3 / 2)
+	localTAB := int64(sim.GenesisBlockTABS * 3 / 2)
 
-	tabs := genesisBlockTABS
-	tabsStep := genesisBlockTABS
+	tabs := sim.GenesisBlockTABS
+	tabsStep := sim.GenesisBlockTABS
 
 	sequentialFalls := int64(0)
 	for i := int64(1); i <= 4*60*24; i++ {
 
-		tabs = getTABS(tabs, localTAB)
+		tabs = sim.getTABS(tabs, localTAB)
 		data = append(data, plotter.XY{X: float64(i), Y: float64(tabs)})
 
 		if localTAB >= tabsStep {
@@ -84,7 +89,7 @@ func TestPlotConsensusScore(t *testing.T) {
 		} else {
 			sequentialFalls++
 		}
-		tabsStep = getTABS_step(tabsStep, sequentialFalls, localTAB)
+		tabsStep = sim.getTABS_step(tabsStep, sequentialFalls, localTAB)
 		dataStep = append(dataStep, plotter.XY{X: float64(i), Y: float64(tabsStep)})
 
 	}
@@ -103,7 +108,7 @@ func TestPlotConsensusScore(t *testing.T) {
 	p.Add(scatterStep)
 	p.Legend.Add("TABS_step", scatterStep)
 
-	if err := p.Save(800, 600, "cs_experiment_1.png"); err != nil {
+	if err := p.Save(800, 600, filepath.Join(t.TempDir(), "cs_experiment_1.png")); err != nil {
 		t.Fatal(err)
 	}
 }
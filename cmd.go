@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: go-miner-sim <command> [flags]
+
+Commands:
+  run        run a single simulation and write stats and plots to an output directory
+  sweep      run a grid of scenario parameters and seeds in parallel, and tabulate the results
+  calibrate  check observed block intervals and win shares against the block discovery model
+
+Run 'go-miner-sim <command> -h' for the command's flags.
+`
+
+func runCLI(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "run":
+		return runCommand(args[1:])
+	case "sweep":
+		return sweepCommand(args[1:])
+	case "calibrate":
+		return calibrateCommand(args[1:])
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return nil
+	}
+	return fmt.Errorf("unknown command: %q\n\n%s", args[0], usage)
+}
+
+func runCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	defaults := DefaultParams()
+
+	scenarioPath := fs.String("scenario", "", "JSON or YAML scenario file declaring the experiment (replaces the simulation flags)")
+	name := fs.String("name", "run", "name of the run, used in the default output directory (default the scenario name)")
+	outDir := fs.String("out", "", "output directory (default out/<name>)")
+	miners := fs.Int64("miners", defaults.CountMiners, "number of (honest) miners")
+	duration := fs.Duration("duration", defaults.Duration(), "simulated time to run for")
+	tps := fs.Int64("ticks-per-second", defaults.TicksPerSecond, "block timestamp ticks per second of simulated time")
+	latency := fs.Float64("latency", defaults.LatencySeconds, "block propagation latency between neighbors, in seconds")
+	latencyDist := fs.String("latency-dist", latencyConstant, "distribution of link latencies: constant or lognormal (with median -latency)")
+	latencySigma := fs.Float64("latency-sigma", 0, "standard deviation of the log of lognormal latencies")
+	bandwidth := fs.Float64("bandwidth", 0, "link bandwidth in megabits per second, which adds each block's transfer time to its latency (default unlimited)")
+	blockSize := fs.Int64("block-size", 0, "block size in bytes")
+	topology := fs.String("topology", topologyRandom, "network graph: "+strings.Join(topologyNames(), ", "))
+	topologyDegree := fs.Int("topology-degree", 0, "degree of randomRegular graphs, ring neighbors in wattsStrogatz graphs, and links per joining miner in barabasiAlbert graphs")
+	topologyP := fs.Float64("topology-p", 0, "link probability of erdosRenyi graphs (default the neighbor rate), and rewiring probability of wattsStrogatz graphs")
+	topologyFile := fs.String("topology-file", "", "edge list file for edgeList graphs: a pair of miner indexes per line")
+	consensus := fs.String("consensus", TD.String(), "consensus algorithm: "+strings.Join(consensusAlgorithmNames(), ", "))
+	freshnessBy := fs.String("freshness-by", freshnessProduced, "what makes a block fresh to TimeDesc miners: produced (its timestamp) or received")
+	freshnessTolerance := fs.Float64("freshness-tolerance", 0, "how many blocks' difficulty lighter a fresher block may be and still be preferred by TimeDesc miners")
+	difficulty := fs.String("difficulty", difficultyByzantium, "difficulty adjustment algorithm: "+strings.Join(difficultyNames(), ", "))
+	difficultyHalfLife := fs.Int64("difficulty-half-life", 0, "half-life of asert difficulty, in seconds (default 288 target block intervals)")
+	tieBreaker := fs.String("tie-breaker", string(defaultTieBreaker), "how miners break ties: "+strings.Join(tieBreakerNames(), ", ")+", optionally prefixed with "+tieSelfFirst+" to prefer their own blocks first")
+	tabsDenominator := fs.Int64("tabs-denominator", defaults.TabsAdjustmentDenominator, "TABS adjustment denominator (lower values prefer richer miners more)")
+	seed := fs.Int64("seed", 0, "seed for all randomness; the same seed reproduces a run exactly (default from the clock, or the scenario's seed)")
+	attacker := fs.Bool("attacker", false, "install a rich 0.9-hashrate miner which withholds its blocks for 8 hours")
+	animate := fs.Bool("anim", false, "write animation frames (and a movie if ffmpeg is available)")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if *scenarioPath != "" {
+		return runScenarioCommand(fs, *scenarioPath, *name, *outDir, *seed, *animate)
+	}
+
+	if *miners < 1 {
+		return errors.New("-miners must be at least 1")
+	}
+	if *tps < 1 {
+		return errors.New("-ticks-per-second must be at least 1")
+	}
+	if *duration < time.Second {
+		return errors.New("-duration must be at least 1s")
+	}
+	if *tabsDenominator < 2 {
+		return errors.New("-tabs-denominator must be at least 2")
+	}
+	algo, err := parseConsensusAlgorithm(*consensus)
+	if err != nil {
+		return err
+	}
+	tb, err := parseTieBreaker(*tieBreaker)
+	if err != nil {
+		return err
+	}
+	difficultySpec := DifficultySpec{Type: *difficulty, HalfLifeSeconds: *difficultyHalfLife}
+	if err := difficultySpec.validate(); err != nil {
+		return fmt.Errorf("-difficulty: %w", err)
+	}
+	freshness := FreshnessSpec{By: *freshnessBy, Tolerance: *freshnessTolerance}
+	if err := freshness.validate(); err != nil {
+		return fmt.Errorf("-freshness: %w", err)
+	}
+	latencySpec := LatencySpec{Type: *latencyDist, Sigma: *latencySigma}
+	if err := latencySpec.validate(); err != nil {
+		return fmt.Errorf("-latency-dist: %w", err)
+	}
+	if *bandwidth < 0 || *blockSize < 0 {
+		return errors.New("-bandwidth and -block-size must not be negative")
+	}
+	topo := TopologySpec{Type: *topology, P: *topologyP, Degree: *topologyDegree, File: *topologyFile}
+	if err := topo.validate(); err != nil {
+		return fmt.Errorf("-topology: %w", err)
+	}
+
+	p := defaults
+	p.Seed = *seed
+	p.CountMiners = *miners
+	p.TicksPerSecond = *tps
+	p.SetDuration(*duration)
+	p.LatencySeconds = *latency
+	p.Latency = latencySpec
+	p.BandwidthMbps = *bandwidth
+	p.BlockSizeBytes = *blockSize
+	p.Topology = topo
+	p.TabsAdjustmentDenominator = *tabsDenominator
+	p.Difficulty = difficultySpec
+	p.Freshness = freshness
+
+	if *outDir == "" {
+		*outDir = filepath.Join("out", *name)
+	}
+
+	return NewSimulation(p).run(runOptions{
+		name:   *name,
+		outDir: *outDir,
+		minerMutation: func(m *Miner) {
+			m.ConsensusAlgorithm = algo
+			m.TieBreaker = tb
+		},
+		attacker: *attacker,
+		animate:  *animate,
+		logf:     log.Printf,
+	})
+}
+
+// scenarioExclusiveFlags are run flags whose values a scenario file declares instead.
+var scenarioExclusiveFlags = map[string]bool{
+	"miners":               true,
+	"duration":             true,
+	"ticks-per-second":     true,
+	"latency":              true,
+	"latency-dist":         true,
+	"latency-sigma":        true,
+	"bandwidth":            true,
+	"block-size":           true,
+	"topology":             true,
+	"topology-degree":      true,
+	"topology-p":           true,
+	"topology-file":        true,
+	"freshness-by":         true,
+	"freshness-tolerance":  true,
+	"consensus":            true,
+	"tie-breaker":          true,
+	"difficulty":           true,
+	"difficulty-half-life": true,
+	"tabs-denominator":     true,
+	"attacker":             true,
+}
+
+func runScenarioCommand(fs *flag.FlagSet, path, name, outDir string, seed int64, animate bool) error {
+	var conflict error
+	fs.Visit(func(f *flag.Flag) {
+		if scenarioExclusiveFlags[f.Name] && conflict == nil {
+			conflict = fmt.Errorf("-%s cannot be combined with -scenario; set it in the scenario file", f.Name)
+		}
+	})
+	if conflict != nil {
+		return conflict
+	}
+
+	sc, err := LoadScenario(path)
+	if err != nil {
+		return err
+	}
+	nameSet := false
+	fs.Visit(func(f *flag.Flag) {
+		nameSet = nameSet || f.Name == "name"
+	})
+	if !nameSet {
+		name = sc.Name
+	}
+	if outDir == "" {
+		outDir = filepath.Join("out", name)
+	}
+
+	p := sc.params()
+	if seed != 0 {
+		p.Seed = seed
+	}
+
+	return NewSimulation(p).run(runOptions{
+		name:      name,
+		outDir:    outDir,
+		newMiners: sc.newMiners,
+		animate:   animate,
+		logf:      log.Printf,
+	})
+}
+
+func sweepCommand(args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ContinueOnError)
+
+	gridPath := fs.String("grid", "", "JSON or YAML grid file declaring the base scenario, seeds and axes to vary")
+	outDir := fs.String("out", "", "output directory; rerunning with the same directory continues an interrupted sweep (default out/sweep/<grid name>)")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of simulations to run at once")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *gridPath == "" {
+		return errors.New("-grid is required")
+	}
+
+	g, base, err := LoadGrid(*gridPath)
+	if err != nil {
+		return err
+	}
+	if *outDir == "" {
+		*outDir = filepath.Join("out", "sweep", g.Name)
+	}
+
+	return runSweep(g, base, sweepOptions{
+		outDir:  *outDir,
+		workers: *workers,
+		logf:    log.Printf,
+	})
+}
+
+func calibrateCommand(args []string) error {
+	fs := flag.NewFlagSet("calibrate", flag.ContinueOnError)
+
+	miners := fs.Int("miners", int(DefaultParams().CountMiners), "number of miners")
+	hashrates := fs.String("hashrates", HashrateDistLongtail.String(), "hashrate distribution: equal or longtail")
+	duration := fs.Duration("duration", 48*time.Hour, "simulated time to run for")
+	seed := fs.Int64("seed", 0, "seed for all randomness (default from the clock)")
+	outDir := fs.String("out", filepath.Join("out", "calibrate"), "output directory")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	c, err := runCalibration(*miners, *hashrates, *duration, *seed, *outDir, log.Printf)
+	if err != nil {
+		return err
+	}
+	fmt.Print(c)
+	if !c.ok() {
+		return fmt.Errorf("calibration failed: an observation is more than %d standard errors from the model", calibrationMaxZ)
+	}
+	return nil
+}
+
+// runCalibration runs a fork-free network (zero latency, every miner a neighbor of every other)
+// and measures it against the discovery model.
+func runCalibration(miners int, hashrates string, duration time.Duration, seed int64, outDir string, logf func(string, ...interface{})) (calibration, error) {
+	neighborRate, latency := float64(1), float64(0)
+	sc := &Scenario{
+		Name:     "calibrate",
+		Seed:     seed,
+		Duration: Duration(duration),
+		Network: NetworkSpec{
+			MinerNeighborRate: &neighborRate,
+			LatencySeconds:    &latency,
+		},
+		Miners: []MinerSpec{{
+			Count:                miners,
+			HashrateDistribution: hashrates,
+			ConsensusAlgorithm:   TD.String(),
+		}},
+	}
+	if err := sc.Validate(); err != nil {
+		return calibration{}, err
+	}
+
+	s := NewSimulation(sc.params())
+	err := s.run(runOptions{
+		name:      sc.Name,
+		outDir:    outDir,
+		newMiners: sc.newMiners,
+		skipPlots: true,
+		logf:      logf,
+	})
+	if err != nil {
+		return calibration{}, err
+	}
+	return s.calibration(), nil
+}
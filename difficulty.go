@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+const (
+	difficultyFrontier   = "frontier"
+	difficultyHomestead  = "homestead"
+	difficultyByzantium  = "byzantium"
+	difficultyETCDefused = "etcDefused"
+	difficultyASERT      = "asert"
+)
+
+// DifficultyAlgorithm computes the difficulty of a block from its parent and its own timestamp.
+// The Ethereum algorithms are exact integer versions of their specifications, which work in whole seconds.
+type DifficultyAlgorithm interface {
+	// Difficulty is the difficulty of a block on parent with timestamp s, in ticks like Block.s.
+	Difficulty(sim *Simulation, parent *Block, s int64) *big.Int
+}
+
+// DifficultySpec declares the difficulty adjustment algorithm. The zero value is Byzantium.
+type DifficultySpec struct {
+	Type string `json:"type"` // frontier, homestead, byzantium (default), etcDefused, asert
+
+	// HalfLifeSeconds is how far an asert chain must fall behind (or get ahead of) schedule
+	// for its difficulty to halve (or double). Zero is 288 target block intervals.
+	HalfLifeSeconds int64 `json:"halfLifeSeconds"`
+}
+
+// difficultyAlgorithms build each algorithm from its spec, by name.
+var difficultyAlgorithms = map[string]func(spec DifficultySpec) DifficultyAlgorithm{
+	difficultyFrontier:   func(DifficultySpec) DifficultyAlgorithm { return frontierDifficulty{} },
+	difficultyHomestead:  func(DifficultySpec) DifficultyAlgorithm { return homesteadDifficulty{} },
+	difficultyByzantium:  func(DifficultySpec) DifficultyAlgorithm { return byzantiumDifficulty{bombDelay: byzantiumBombDelay} },
+	difficultyETCDefused: func(DifficultySpec) DifficultyAlgorithm { return byzantiumDifficulty{defused: true} },
+	difficultyASERT: func(spec DifficultySpec) DifficultyAlgorithm {
+		if spec.HalfLifeSeconds == 0 {
+			spec.HalfLifeSeconds = asertHalfLifeBlocks * targetBlockSeconds
+		}
+		return asertDifficulty{halfLife: spec.HalfLifeSeconds}
+	},
+}
+
+func (d DifficultySpec) typeName() string {
+	if d.Type == "" {
+		return difficultyByzantium
+	}
+	return d.Type
+}
+
+func (d DifficultySpec) validate() error {
+	if _, ok := difficultyAlgorithms[d.typeName()]; !ok {
+		return fmt.Errorf("unknown type %q (want one of %s)", d.Type, strings.Join(difficultyNames(), ", "))
+	}
+	if d.HalfLifeSeconds < 0 {
+		return fmt.Errorf("halfLifeSeconds must not be negative, got %d", d.HalfLifeSeconds)
+	}
+	if d.HalfLifeSeconds != 0 && d.typeName() != difficultyASERT {
+		return fmt.Errorf("halfLifeSeconds only applies to %s", difficultyASERT)
+	}
+	return nil
+}
+
+func (d DifficultySpec) algorithm() DifficultyAlgorithm {
+	return difficultyAlgorithms[d.typeName()](d)
+}
+
+func difficultyNames() (names []string) {
+	for name := range difficultyAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+const (
+	minimumDifficulty      = 131072
+	difficultyBoundDivisor = 2048
+	expDiffPeriod          = 100000
+	byzantiumBombDelay     = 3000000
+)
+
+// bomb is the exponential "ice age" term for block number n.
+func bomb(n int64) *big.Int {
+	period := n / expDiffPeriod
+	if period < 2 {
+		return new(big.Int)
+	}
+	return new(big.Int).Lsh(big.NewInt(1), uint(period-2))
+}
+
+// timestamps returns the times of parent and a block at s, in whole seconds.
+func (p Params) timestamps(parent *Block, s int64) (parentTime, time int64) {
+	return parent.s / p.TicksPerSecond, s / p.TicksPerSecond
+}
+
+// adjusted is the parent's difficulty, adjusted by x steps of 1/difficultyBoundDivisor of it,
+// but no less than the minimum difficulty.
+func adjusted(parent *Block, x int64) *big.Int {
+	d := new(big.Int).Quo(parent.d, big.NewInt(difficultyBoundDivisor))
+	d.Mul(d, big.NewInt(x))
+	d.Add(d, parent.d)
+	if d.Cmp(big.NewInt(minimumDifficulty)) < 0 {
+		d.SetInt64(minimumDifficulty)
+	}
+	return d
+}
+
+// frontierDifficulty steps the difficulty up after a block within 13 seconds of its parent, and down otherwise.
+type frontierDifficulty struct{}
+
+func (frontierDifficulty) Difficulty(sim *Simulation, parent *Block, s int64) *big.Int {
+	parentTime, time := sim.timestamps(parent, s)
+	x := int64(-1)
+	if time-parentTime < 13 {
+		x = 1
+	}
+	d := adjusted(parent, x)
+	return d.Add(d, bomb(parent.i+1))
+}
+
+// homesteadDifficulty (EIP-2) adjusts the difficulty in proportion to how far the interval is from 10-19 seconds.
+type homesteadDifficulty struct{}
+
+func (homesteadDifficulty) Difficulty(sim *Simulation, parent *Block, s int64) *big.Int {
+	parentTime, time := sim.timestamps(parent, s)
+	x := 1 - (time-parentTime)/10
+	if x < -99 {
+		x = -99
+	}
+	d := adjusted(parent, x)
+	return d.Add(d, bomb(parent.i+1))
+}
+
+// byzantiumDifficulty (EIP-100) targets 9-18 second intervals, and counts a parent with uncles as an extra block,
+// so that forks do not lower the difficulty. Its bomb is delayed by bombDelay blocks,
+// and ETC's (ECIP-1041) is defused altogether.
+type byzantiumDifficulty struct {
+	bombDelay int64
+	defused   bool
+}
+
+func (b byzantiumDifficulty) Difficulty(sim *Simulation, parent *Block, s int64) *big.Int {
+	parentTime, time := sim.timestamps(parent, s)
+	y := int64(1)
+	if len(parent.uncles) > 0 {
+		y = 2
+	}
+	x := y - (time-parentTime)/9
+	if x < -99 {
+		x = -99
+	}
+	d := adjusted(parent, x)
+	if b.defused {
+		return d
+	}
+	if fake := parent.i + 1 - b.bombDelay; fake > 0 {
+		d.Add(d, bomb(fake))
+	}
+	return d
+}
+
+// asertHalfLifeBlocks is the default ASERT half-life, in target block intervals (as in Bitcoin Cash's aserti3-2d).
+const asertHalfLifeBlocks = 288
+
+// asertDifficulty is absolutely scheduled exponentially rising targets (ASERT, aserti3-2d), the exact form of
+// an exponential moving average of block intervals: the difficulty is the genesis difficulty, doubled for every
+// half-life the chain is ahead of its schedule of one block per target interval since genesis.
+// It uses aserti3-2d's fixed-point approximation of 2^x.
+type asertDifficulty struct {
+	halfLife int64 // seconds
+}
+
+func (a asertDifficulty) Difficulty(sim *Simulation, parent *Block, s int64) *big.Int {
+	// aserti3-2d measures time from the anchor's parent; anchored at genesis, which has none,
+	// the schedule is one block fewer: a parent on schedule keeps the genesis difficulty.
+	anchor := sim.genesis
+	timeDelta := (parent.s - anchor.s) / sim.TicksPerSecond
+	heightDelta := parent.i - anchor.i
+
+	exponent := (targetBlockSeconds*heightDelta - timeDelta) * 65536 / a.halfLife
+	shifts := exponent >> 16
+	frac := uint64(exponent & 0xffff)
+	factor := 65536 + int64((195766423245049*frac+971821376*frac*frac+5127*frac*frac*frac+1<<47)>>48)
+
+	d := new(big.Int).Mul(anchor.d, big.NewInt(factor))
+	if shifts -= 16; shifts < 0 {
+		d.Rsh(d, uint(-shifts))
+	} else {
+		d.Lsh(d, uint(shifts))
+	}
+	if d.Sign() == 0 {
+		d.SetInt64(1)
+	}
+	return d
+}
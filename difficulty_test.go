@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestDifficulty_Ethereum(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	tick := sim.TicksPerSecond
+	parent := &Block{i: 100, s: 1000 * tick, d: big.NewInt(1000000)}
+	uncled := &Block{i: 100, s: 1000 * tick, d: big.NewInt(1000000), uncles: []*Block{{}}}
+	bombed := &Block{i: byzantiumBombDelay + 2*expDiffPeriod - 1, s: 1000 * tick, d: big.NewInt(1000000)}
+	floor := &Block{i: 100, s: 1000 * tick, d: big.NewInt(minimumDifficulty)}
+
+	const step = 1000000 / difficultyBoundDivisor // 488
+	for _, c := range []struct {
+		algo    string
+		parent  *Block
+		seconds int64 // since the parent
+		want    int64
+	}{
+		{difficultyFrontier, parent, 12, 1000000 + step},
+		{difficultyFrontier, parent, 13, 1000000 - step},
+		{difficultyFrontier, floor, 100, minimumDifficulty},
+		{difficultyHomestead, parent, 5, 1000000 + step},
+		{difficultyHomestead, parent, 15, 1000000},
+		{difficultyHomestead, parent, 25, 1000000 - step},
+		{difficultyHomestead, parent, 5000, 1000000 - 99*step},
+		{difficultyByzantium, parent, 5, 1000000 + step},
+		{difficultyByzantium, parent, 9, 1000000},
+		{difficultyByzantium, uncled, 9, 1000000 + step},
+		{difficultyByzantium, uncled, 27, 1000000 - step},
+		{difficultyByzantium, bombed, 9, 1000000 + 1},
+		{difficultyETCDefused, bombed, 9, 1000000},
+		{difficultyETCDefused, uncled, 9, 1000000 + step},
+	} {
+		// Timestamps are whole seconds, so a fraction of a second makes no difference.
+		s := c.parent.s + c.seconds*tick + tick/2
+		if got := (DifficultySpec{Type: c.algo}).algorithm().Difficulty(sim, c.parent, s); got.Cmp(big.NewInt(c.want)) != 0 {
+			t.Errorf("%s after %ds on %d: %d want %d", c.algo, c.seconds, c.parent.d, got, c.want)
+		}
+	}
+}
+
+func TestDifficulty_ASERT(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	sim.genesis.d = big.NewInt(1000000)
+	tick := sim.TicksPerSecond
+	asert := DifficultySpec{Type: difficultyASERT, HalfLifeSeconds: 100}.algorithm()
+
+	for _, c := range []struct {
+		seconds int64 // of the parent, block 10, since genesis
+		want    int64
+	}{
+		{10 * targetBlockSeconds, 1000000},     // on schedule
+		{10*targetBlockSeconds - 100, 2000000}, // a half-life ahead
+		{10*targetBlockSeconds + 100, 500000},  // a half-life behind
+		{10*targetBlockSeconds - 50, 1414093},  // half a half-life ahead: sqrt(2), as aserti3-2d approximates it
+		{10*targetBlockSeconds + 100000, 1},    // far behind
+	} {
+		parent := &Block{i: 10, s: c.seconds * tick}
+		if got := asert.Difficulty(sim, parent, parent.s+tick); got.Cmp(big.NewInt(c.want)) != 0 {
+			t.Errorf("parent at %ds: %d want %d", c.seconds, got, c.want)
+		}
+	}
+
+	// A thousand half-lives ahead: 2^1000 times the genesis difficulty, beyond any fixed-size integer.
+	parent := &Block{i: 10000, s: (10000*targetBlockSeconds - 100000) * tick}
+	want := new(big.Int).Lsh(sim.genesis.d, 1000)
+	if got := asert.Difficulty(sim, parent, parent.s+tick); got.Cmp(want) != 0 {
+		t.Errorf("far ahead: %d want %d", got, want)
+	}
+}
+
+func TestStartMining_Active(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.HashesPerTick = 1e12
+
+	m.ActiveFrom = 100
+	m.startMining()
+	if at := m.discovery.at; at < 100 || at > 101 {
+		t.Errorf("discovery at %f want soon after 100", at)
+	}
+
+	m.ActiveFrom, m.ActiveUntil = 0, 1e-9
+	m.startMining()
+	if at := m.discovery.at; !math.IsInf(at, 1) {
+		t.Errorf("discovery at %f want never", at)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Block discovery model.
+//
+// Each hash a miner tries solves the puzzle on a parent of difficulty d with probability 1/d,
+// independently of every other hash. A miner tries HashesPerTick/targetBlockSeconds hashes
+// per second (HashesPerTick is the hashing power per target block time, so a network whose
+// HashesPerTick sum to the difficulty finds one block per targetBlockSeconds).
+// Hashes are many and each is unlikely to succeed, so a miner's solutions arrive as a Poisson
+// process with rate
+//
+//	λ = HashesPerTick / d / targetBlockSeconds   (solutions per second)
+//
+// Equivalently, the probability of a solution within one tick is 1 - exp(-λ/TicksPerSecond),
+// and the time from starting on a parent to solving it is exponentially distributed with mean 1/λ.
+// Because the process is memoryless, a miner that changes its head simply draws a new time.
+// Across miners, the rates add: the network finds blocks at Σλ, and each block
+// is the work of a given miner with probability λ/Σλ, ie. its share of the hashing power.
+
+// targetBlockSeconds is the mean block interval when the network's hashing power equals the difficulty.
+const targetBlockSeconds = 13
+
+// discoveryRate is the rate, in solutions per second, at which hashes finds blocks on a parent of difficulty d.
+func discoveryRate(hashes int64, d *big.Int) float64 {
+	return float64(hashes) / bigFloat(d) / targetBlockSeconds
+}
+
+// calibrationMaxZ is the largest deviation, in standard errors, that a calibration accepts.
+const calibrationMaxZ = 4
+
+// calibration compares the canonical chain of a run with the discovery model.
+// The model describes the discovery of blocks, and the chain only reflects it when there are no forks:
+// calibrate runs with zero latency on a fully connected network, where every miner always mines on the same head.
+type calibration struct {
+	Blocks int
+
+	// IntervalMean is the observed mean block interval, and IntervalExpected the model's mean
+	// given each block's parent difficulty, in seconds.
+	IntervalMean     float64
+	IntervalExpected float64
+	IntervalZ        float64
+
+	Miners []minerCalibration
+}
+
+type minerCalibration struct {
+	Address       string
+	Wins          int
+	Share         float64 // of the canonical blocks
+	ShareExpected float64 // of the hashing power
+	Z             float64
+}
+
+// calibration measures the run against the discovery model.
+func (s *Simulation) calibration() calibration {
+	var hashes int64
+	for _, m := range s.miners {
+		hashes += m.HashesPerTick
+	}
+
+	chain, head := s.miners[0].Chain, s.miners[0].head.i
+	wins := make(map[string]int)
+	var observed, expected, variance float64
+	for i := int64(1); i <= head; i++ {
+		b := chain[i]
+		parent := chain[i-1]
+
+		// The interval is exponentially distributed, so its variance is its mean squared.
+		mean := 1 / discoveryRate(hashes, parent.d)
+		observed += s.seconds(b.si)
+		expected += mean
+		variance += mean * mean
+
+		wins[b.miner]++
+	}
+
+	n := float64(head)
+	c := calibration{Blocks: int(head)}
+	if n == 0 {
+		return c
+	}
+	c.IntervalMean = observed / n
+	c.IntervalExpected = expected / n
+	c.IntervalZ = (observed - expected) / math.Sqrt(variance)
+
+	for _, m := range s.miners {
+		// Each block is the miner's with probability p, so its wins are binomial.
+		p := float64(m.HashesPerTick) / float64(hashes)
+		w := float64(wins[m.Address])
+		mc := minerCalibration{
+			Address:       m.Address,
+			Wins:          wins[m.Address],
+			Share:         w / n,
+			ShareExpected: p,
+		}
+		if sd := math.Sqrt(n * p * (1 - p)); sd > 0 {
+			mc.Z = (w - n*p) / sd
+		}
+		c.Miners = append(c.Miners, mc)
+	}
+	return c
+}
+
+// ok tells whether every observation is within calibrationMaxZ standard errors of the model.
+func (c calibration) ok() bool {
+	if c.Blocks == 0 || math.Abs(c.IntervalZ) > calibrationMaxZ {
+		return false
+	}
+	for _, m := range c.Miners {
+		if math.Abs(m.Z) > calibrationMaxZ {
+			return false
+		}
+	}
+	return true
+}
+
+func (c calibration) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "blocks=%d interval_mean=%0.3fs expected=%0.3fs z=%+0.2f\n", c.Blocks, c.IntervalMean, c.IntervalExpected, c.IntervalZ)
+	for _, m := range c.Miners {
+		fmt.Fprintf(&out, "a=%s wins=%d share=%0.4f expected=%0.4f z=%+0.2f\n", m.Address, m.Wins, m.Share, m.ShareExpected, m.Z)
+	}
+	return out.String()
+}
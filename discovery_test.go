@@ -0,0 +1,39 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryRate(t *testing.T) {
+	// A network whose hashing power equals the difficulty finds a block per target block time,
+	// however that power is split among miners.
+	var rate float64
+	for _, hr := range generateMinerHashrates(HashrateDistLongtail, 12) {
+		rate += discoveryRate(int64(hr*genesisDifficulty), big.NewInt(genesisDifficulty))
+	}
+	if got := 1 / rate; math.Abs(got-targetBlockSeconds) > 1e-6 {
+		t.Fatalf("mean interval=%v want=%v", got, targetBlockSeconds)
+	}
+	if got := discoveryRate(genesisDifficulty, big.NewInt(2*genesisDifficulty)); got != 1.0/(2*targetBlockSeconds) {
+		t.Fatalf("rate at double difficulty=%v", got)
+	}
+}
+
+func TestCalibration(t *testing.T) {
+	for _, hashrates := range []string{"equal", "longtail"} {
+		c, err := runCalibration(6, hashrates, 24*time.Hour, 7, t.TempDir(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%s:\n%s", hashrates, c)
+		if c.Blocks < 6000 {
+			t.Errorf("%s: only %d blocks", hashrates, c.Blocks)
+		}
+		if !c.ok() {
+			t.Errorf("%s: calibration failed", hashrates)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"math"
+)
+
+// A double-spend attack: a merchant accepts a payment once the block with its transaction,
+// block TxBlock, has Confirmations confirmations (the block itself and those on it),
+// while the attacker mines a private fork from the block below, with a conflicting transaction.
+// If the fork overtakes the public chain once the merchant has accepted, the attacker releases it;
+// the attack succeeds if the honest miners' fork choices then replace the transaction's block with it.
+//
+// Across seeds, the success rate approaches the probability Nakamoto ("Bitcoin", 2008, section 11)
+// and Rosenfeld ("Analysis of Hashrate-Based Double Spending", 2014) estimate in closed form.
+// Rosenfeld's attacker has mined a block of its fork by the time the merchant's transaction is first
+// included, so that catching up with the public chain suffices; the simulated one starts with
+// the honest miners, and must get ahead by its fork choice.
+// Both estimates also let the attacker catch up however far behind it falls, and however long that takes;
+// the simulated one gives up doubleSpendGiveUpBehind blocks behind, and has only the run's duration,
+// so its success rate falls below them, and is not directly comparable.
+
+// doubleSpendGiveUpBehind is how many blocks behind the public chain the attacker gives up by default.
+// Twenty behind, the fork is all but hopeless even for an attacker with 40% of the hashing power.
+const doubleSpendGiveUpBehind = 20
+
+// doubleSpendStrategy mines honestly up to block TxBlock-1, and then a private fork from it,
+// until it releases the fork, or gives up, when it mines honestly again.
+// It also keeps the record of the attack, for the run's summary.
+type doubleSpendStrategy struct {
+	honestStrategy
+	n, z, giveUp int64 // giveUp zero is never
+
+	address  string
+	fork     *Block // the attacker's block TxBlock-1, which the private fork grows from
+	tx       *Block // the private fork's block TxBlock, which leaves the merchant's transaction out
+	tip      *Block // the private fork's latest block, or fork
+	public   *Block // the public block the attacker's fork choice prefers
+	released bool
+	gaveUp   bool
+
+	// confirmedAt is when the first honest miner had the transaction's block confirmed Confirmations times,
+	// and adopted when each honest miner last made the private fork's block TxBlock canonical;
+	// both are in seconds since genesis.
+	confirmedAt float64
+	adopted     map[*Miner]float64
+}
+
+// start forks from block TxBlock-1 once the miner has it, returning whether the attack is on.
+func (s *doubleSpendStrategy) start(v MinerView) bool {
+	if s.fork == nil && v.Head().i >= s.n-1 {
+		s.address = v.Address()
+		s.fork = v.Ancestor(v.Head(), s.n-1)
+		s.tip = s.fork
+		s.confirmedAt = math.Inf(1)
+	}
+	return s.fork != nil && !s.released && !s.gaveUp
+}
+
+// overtaken tells whether the merchant's transaction is confirmed in the public chain, as the attacker sees it,
+// and the attacker's fork choice prefers its private fork to it.
+func (s *doubleSpendStrategy) overtaken(v MinerView) bool {
+	return s.public != nil && s.public.i-s.n+1 >= s.z && s.tip.i >= s.n && v.Prefers(s.public, s.tip)
+}
+
+func (s *doubleSpendStrategy) BlockMined(v MinerView, b *Block) []Action {
+	if !s.start(v) {
+		return nil
+	}
+	if b.ph != s.tip.h {
+		// The attack started as the miner mined above block TxBlock-1.
+		return []Action{SwitchParent(s.tip)}
+	}
+	s.tip = b
+	if b.ph == s.fork.h {
+		s.tx = b
+	}
+	if s.overtaken(v) {
+		s.released = true
+		return []Action{Release(v.Head()), Publish(b), SwitchParent(b)}
+	}
+	return []Action{WithholdUntil(b, math.Inf(1)), SwitchParent(b)}
+}
+
+func (s *doubleSpendStrategy) BlockReceived(v MinerView, b *Block) []Action {
+	if !s.start(v) {
+		return nil
+	}
+	if v.Has(b) || b.miner == s.address || b.i < s.n {
+		return []Action{SwitchParent(s.tip)}
+	}
+	if s.public == nil || v.Prefers(s.public, b) {
+		s.public = b
+	}
+	if s.giveUp > 0 && s.public.i-s.tip.i > s.giveUp {
+		s.gaveUp = true
+		return nil
+	}
+	if s.overtaken(v) {
+		s.released = true
+		return []Action{Release(s.tip), SwitchParent(s.tip)}
+	}
+	return []Action{SwitchParent(s.tip)}
+}
+
+// HeadChanged moves the miner back to its fork if, as the attack starts, the miner is above it.
+func (s *doubleSpendStrategy) HeadChanged(v MinerView, head *Block) []Action {
+	if s.start(v) && head != s.tip {
+		return []Action{SwitchParent(s.tip)}
+	}
+	return nil
+}
+
+// canon records honest miner m adding b to, or dropping it from, its canonical chain.
+func (s *doubleSpendStrategy) canon(m *Miner, b *Block, added bool) {
+	if m.Attacker || s.fork == nil {
+		return
+	}
+	switch {
+	case s.onFork(b):
+		if s.adopted == nil {
+			s.adopted = make(map[*Miner]float64)
+		}
+		if added {
+			s.adopted[m] = m.sim.sched.now
+		} else {
+			delete(s.adopted, m)
+		}
+	case added && b.i == s.n+s.z-1 && m.sim.sched.now < s.confirmedAt:
+		if tx := m.Blocks.ancestorAt(b, s.n); tx != nil && !s.onFork(tx) {
+			s.confirmedAt = m.sim.sched.now
+		}
+	}
+}
+
+// onFork tells whether b is the private fork's block TxBlock, which the attacker withheld as it mined the fork,
+// rather than just any block of the attacker's at that number.
+func (s *doubleSpendStrategy) onFork(b *Block) bool {
+	return s.tx != nil && b.h == s.tx.h && b.ph == s.fork.h
+}
+
+// result tells whether the attack succeeded: every honest miner has replaced the transaction's block
+// with the attacker's, after the merchant accepted it. after is how long after it was accepted they all had.
+func (s *doubleSpendStrategy) result(miners []*Miner) (success bool, after float64) {
+	if s.fork == nil || math.IsInf(s.confirmedAt, 1) {
+		return false, 0
+	}
+	last := s.confirmedAt
+	for _, m := range miners {
+		if m.Attacker {
+			continue
+		}
+		at, ok := s.adopted[m]
+		if !ok {
+			return false, 0
+		}
+		if at > last {
+			last = at
+		}
+	}
+	return true, last - s.confirmedAt
+}
+
+// nakamotoDoubleSpend is Nakamoto's estimate of the probability that an attacker with share q of the hashing power
+// ever catches up with z confirmations: the attacker's progress while the honest miners mine z blocks
+// is taken to be Poisson, with mean z*q/p.
+func nakamotoDoubleSpend(q float64, z int64) float64 {
+	p := 1 - q
+	if q >= p {
+		return 1
+	}
+	lambda := float64(z) * q / p
+	sum := 1.0
+	poisson := math.Exp(-lambda)
+	for k := int64(0); k <= z; k++ {
+		if k > 0 {
+			poisson *= lambda / float64(k)
+		}
+		sum -= poisson * (1 - math.Pow(q/p, float64(z-k)))
+	}
+	return sum
+}
+
+// rosenfeldDoubleSpend is Rosenfeld's exact probability that an attacker with share q of the hashing power
+// overtakes z confirmations: while the honest miners mine z blocks, the attacker mines m with the negative binomial
+// distribution, and then catches up from behind with probability (q/p)^deficit.
+// Rosenfeld's attacker has a block premined, so it needs z-m blocks more; without, it needs z-m+1.
+func rosenfeldDoubleSpend(q float64, z int64, premined bool) float64 {
+	p := 1 - q
+	if q >= p {
+		return 1
+	}
+	need := z
+	if !premined {
+		need++
+	}
+	// The attacker fails only if it has mined fewer than it needs, and then never catches up.
+	fail := 0.0
+	pm := math.Pow(p, float64(z)) // P(m=0)
+	for m := int64(0); m < need; m++ {
+		if m > 0 {
+			pm *= q * float64(m+z-1) / float64(m)
+		}
+		fail += pm * (1 - math.Pow(q/p, float64(need-m)))
+	}
+	return 1 - fail
+}
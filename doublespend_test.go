@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDoubleSpend_Analytic(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		// Nakamoto's table, section 11.
+		{"nakamoto q=0.1 z=1", nakamotoDoubleSpend(0.1, 1), 0.2045873},
+		{"nakamoto q=0.1 z=5", nakamotoDoubleSpend(0.1, 5), 0.0009137},
+		{"nakamoto q=0.3 z=5", nakamotoDoubleSpend(0.3, 5), 0.1773523},
+		// Rosenfeld's: with one confirmation, the attacker wins if it ever gets one block ahead, (q/p)^0 after the premine.
+		{"rosenfeld q=0.1 z=1", rosenfeldDoubleSpend(0.1, 1, true), 0.2},
+		{"rosenfeld q=0.3 z=6", rosenfeldDoubleSpend(0.3, 6, true), 0.1564},
+		// Without it, the attacker needs two blocks before the honest miners' first (q^2), or catches up from behind.
+		{"rosenfeld q=0.1 z=1 no premine", rosenfeldDoubleSpend(0.1, 1, false), 0.1*0.1 + 0.9*0.1*(0.1/0.9) + 0.9*(0.1/0.9)*(0.1/0.9)},
+		{"majority", rosenfeldDoubleSpend(0.5, 6, false), 1},
+		{"majority nakamoto", nakamotoDoubleSpend(0.6, 6), 1},
+	} {
+		if math.Abs(c.got-c.want) > 1e-4 {
+			t.Errorf("%s: %0.7f want %0.7f", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestDoubleSpend_GiveUpBehind(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	never := int64(0)
+	for _, c := range []struct {
+		name   string
+		giveUp *int64
+		want   int64
+	}{
+		{"unset", nil, doubleSpendGiveUpBehind},
+		{"zero", &never, 0},
+	} {
+		s := StrategySpec{Type: strategyDoubleSpend, TxBlock: 2, Confirmations: 2, GiveUpBehind: c.giveUp}.strategy(sim).(*doubleSpendStrategy)
+		if s.giveUp != c.want {
+			t.Errorf("giveUpBehind %s: gives up %d behind want %d", c.name, s.giveUp, c.want)
+		}
+	}
+}
+
+func TestDoubleSpend_Strategy(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.Attacker = true
+	s := StrategySpec{Type: strategyDoubleSpend, TxBlock: 2, Confirmations: 2}.strategy(sim).(*doubleSpendStrategy)
+	m.Strategy = s
+	m.Latency = func(*Miner, *Block) float64 { return 0 }
+	merchant := newTestMiner(t, sim, "00000b")
+	m.neighbors = []*Miner{merchant}
+	sim.miners = Miners{m, merchant}
+	sim.doubleSpender = s
+
+	mine := func() *Block {
+		sim.sched.now += 10
+		m.mine()
+		return m.head
+	}
+	// honest delivers an honest block on parent to both miners.
+	honest := func(parent *Block) *Block {
+		sim.sched.now += 10
+		b := honestChild(sim, parent)
+		receive(merchant, b)
+		receive(m, b)
+		return b
+	}
+
+	// The attacker forks from block 1, the public chain includes the transaction in block 2, and confirms it in block 3.
+	h1 := honest(sim.genesis)
+	a2 := mine()
+	if s.tx != a2 {
+		t.Fatalf("fork's block 2 %v want %v", s.tx, a2)
+	}
+	// Another block of the attacker's at number 2, off the private fork, doesn't count as the merchant adopting the fork.
+	other := honestChild(sim, h1)
+	other.miner = m.Address
+	s.canon(merchant, other, true)
+	if _, ok := s.adopted[merchant]; ok {
+		t.Fatalf("adopted %v, which is not on the fork", other)
+	}
+	h2 := honest(h1)
+	a3 := mine()
+	honest(h2)
+	if m.head != a3 || merchant.Blocks.has(a2) || merchant.Blocks.has(a3) {
+		t.Fatalf("before release: head %v, published %v %v", m.head, merchant.Blocks.has(a2), merchant.Blocks.has(a3))
+	}
+	if s.confirmedAt != sim.sched.now {
+		t.Errorf("confirmed at %v want %v", s.confirmedAt, sim.sched.now)
+	}
+	if success, _ := s.result(sim.miners); success {
+		t.Fatal("succeeded before release")
+	}
+
+	// Ahead of the confirmed chain, the attacker releases its fork, which replaces the transaction's block.
+	a4 := mine()
+	if !merchant.Blocks.has(a2) || merchant.head != a4 || merchant.Chain[2] != a2 {
+		t.Fatalf("after release: merchant head %v block 2 %v", merchant.head, merchant.Chain[2])
+	}
+	success, after := s.result(sim.miners)
+	if !success || after != 10 {
+		t.Errorf("result %v after %v want true after 10", success, after)
+	}
+
+	// Released, the attacker mines honestly.
+	h5 := honest(a4)
+	if m.head != h5 {
+		t.Errorf("head %v want %v", m.head, h5)
+	}
+}
+
+// TestDoubleSpend_SuccessRate checks the attacker's success rate across seeds against Rosenfeld's probability
+// for an attacker without a premined block, on a network without latency or forks of its own, and with constant difficulty.
+func TestDoubleSpend_SuccessRate(t *testing.T) {
+	rate, latency := 1.0, 0.0
+	const seeds = 200
+	for _, z := range []int64{1, 3} {
+		var wins, q float64
+		for seed := int64(1); seed <= seeds; seed++ {
+			sc := &Scenario{
+				Name:       "double_spend_rate",
+				Seed:       seed,
+				Duration:   Duration(20 * time.Minute),
+				Network:    NetworkSpec{MinerNeighborRate: &rate, LatencySeconds: &latency},
+				Difficulty: DifficultySpec{Type: difficultyASERT, HalfLifeSeconds: 1e12},
+				Miners: []MinerSpec{
+					{Count: 4, HashrateDistribution: "equal", ConsensusAlgorithm: TD.String()},
+					{Name: "ff0000", Hashrate: 0.5, ConsensusAlgorithm: TD.String(), Strategy: &StrategySpec{Type: strategyDoubleSpend, TxBlock: 3, Confirmations: z}},
+				},
+			}
+			if err := sc.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			s := NewSimulation(sc.params())
+			err := s.run(runOptions{name: sc.Name, outDir: t.TempDir(), newMiners: sc.newMiners, skipPlots: true, logf: func(string, ...interface{}) {}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := s.summary()
+			q = r.AttackerHashrateShare
+			wins += r.DoubleSpendSuccess
+		}
+		got, want := wins/seeds, rosenfeldDoubleSpend(q, z, false)
+		if math.Abs(got-want) > 0.1 {
+			t.Errorf("z %d: success rate %0.3f want %0.3f", z, got, want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// An eclipse attack (Heilman et al., "Eclipse Attacks on Bitcoin's Peer-to-Peer Network", 2015):
+// the attacker occupies a victim miner's connections, so that the victim sees the network through the attacker.
+// It can then drop or delay the blocks it relays to the victim, and feed it a chain of its own, withheld from
+// everyone else, for the victim to waste its hashing power on. How far the victim's view drifts from the honest
+// miners' depends on how many of its links the attacker holds, and on the victim's fork choice.
+
+// eclipseStrategy relays blocks honestly, but for those it sends the victim: it drops the other miners' blocks,
+// if filter is set, or delays them. If feed is set, it mines a private chain, which it sends the victim alone,
+// and which takes in the blocks the victim mines on it.
+type eclipseStrategy struct {
+	honestStrategy
+	victim       string
+	occupy       float64
+	delay        *DelayPolicy
+	filter, feed bool
+
+	fork    *Block          // the block the private chain grows from: the miner's head as the attack starts
+	tip     *Block          // the private chain's highest block, or fork
+	private map[string]bool // the hashes of the private chain's blocks, the victim's included
+}
+
+// start forks the private chain from the miner's head, the first time a hook is called.
+func (s *eclipseStrategy) start(v MinerView) {
+	if s.fork == nil {
+		s.fork, s.tip = v.Head(), v.Head()
+		s.private = make(map[string]bool)
+	}
+}
+
+func (s *eclipseStrategy) BlockMined(v MinerView, b *Block) []Action {
+	if !s.feed {
+		return nil
+	}
+	s.start(v)
+	s.extend(b)
+	return []Action{WithholdUntil(b, math.Inf(1)), SwitchParent(b)}
+}
+
+func (s *eclipseStrategy) BlockReceived(v MinerView, b *Block) []Action {
+	if !s.feed {
+		return nil
+	}
+	s.start(v)
+	if b.miner == s.victim && !v.Has(b) && (b.ph == s.fork.h || s.private[b.ph]) {
+		// The victim mined on the private chain: keep its block from the network too.
+		s.extend(b)
+		return []Action{WithholdUntil(b, math.Inf(1)), SwitchParent(s.tip)}
+	}
+	return []Action{SwitchParent(s.tip)}
+}
+
+// extend adds b to the private chain.
+func (s *eclipseStrategy) extend(b *Block) {
+	s.private[b.h] = true
+	if b.i > s.tip.i {
+		s.tip = b
+	}
+}
+
+// Relay sends the victim the private chain at once, and the rest filtered or delayed; other neighbors get the public blocks as usual.
+func (s *eclipseStrategy) Relay(v MinerView, b *Block, to string, withhold float64) float64 {
+	if to != s.victim {
+		return withhold
+	}
+	if s.private[b.h] {
+		return 0
+	}
+	if math.IsInf(withhold, 1) || s.filter {
+		return math.Inf(1)
+	}
+	return withhold + s.delay.seconds(v, b)
+}
+
+// eclipse makes attacker take over a share occupy of the victim's links: the victim stops hearing from that many
+// of the miners that send it blocks, and sending to that many of its neighbors, picked at random,
+// and is linked with the attacker both ways instead.
+// It fails if the victim's former neighbors are left unable to reach the rest of the network.
+func (g graph) eclipse(victim, attacker int, occupy float64, r *rand.Rand) error {
+	var in, out []int
+	for u := range g {
+		if u == victim || u == attacker {
+			continue
+		}
+		if g.has(u, victim) {
+			in = append(in, u)
+		}
+		if g.has(victim, u) {
+			out = append(out, u)
+		}
+	}
+	take := func(peers []int) []int {
+		r.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+		return peers[:int(math.Round(occupy*float64(len(peers))))]
+	}
+	for _, u := range take(in) {
+		g.drop(u, victim)
+	}
+	for _, u := range take(out) {
+		g.drop(victim, u)
+	}
+	if !g.has(victim, attacker) {
+		g[victim] = append(g[victim], attacker)
+	}
+	if !g.has(attacker, victim) {
+		g[attacker] = append(g[attacker], victim)
+	}
+	if from, to, ok := g.connected(); !ok {
+		return fmt.Errorf("eclipsing miner %d disconnects the network: miner %d cannot reach miner %d", victim, from, to)
+	}
+	return nil
+}
+
+// eclipseResult measures how the victim fared against honest, the honest miner with the highest head:
+// the share of the victim's blocks outside honest's chain, and how many blocks apart their heads are,
+// counting both ways from their common ancestor.
+func eclipseResult(victim, honest *Miner) (wasted float64, divergence int64) {
+	var mined, orphaned int
+	for _, bs := range victim.Blocks {
+		for _, b := range bs {
+			if b.miner != victim.Address {
+				continue
+			}
+			mined++
+			if c := honest.Chain[b.i]; c == nil || c.h != b.h {
+				orphaned++
+			}
+		}
+	}
+	if mined > 0 {
+		wasted = float64(orphaned) / float64(mined)
+	}
+	common := victim.head.i
+	if honest.head.i < common {
+		common = honest.head.i
+	}
+	for common > 0 && victim.Chain[common].h != honest.Chain[common].h {
+		common--
+	}
+	return wasted, victim.head.i - common + honest.head.i - common
+}
+
+// eclipse returns the miner an eclipse attacker surrounds, and the attacker's strategy, or nils if there is none.
+func (s *Simulation) eclipse() (victim *Miner, e *eclipseStrategy) {
+	for _, m := range s.miners {
+		if st, ok := m.Strategy.(*eclipseStrategy); ok {
+			return s.minerByAddress(st.victim), st
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// newTestEclipse returns an eclipse attacker, with an honest neighbor and its victim, both of which receive what it sends at once.
+func newTestEclipse(t *testing.T, spec StrategySpec) (sim *Simulation, attacker, honest, victim *Miner) {
+	sim = NewSimulation(DefaultParams())
+	attacker = newTestMiner(t, sim, "00000a")
+	spec.Type, spec.Victim = strategyEclipse, "00000c"
+	attacker.Strategy = spec.strategy(sim)
+	attacker.Latency = func(*Miner, *Block) float64 { return 0 }
+	honest = newTestMiner(t, sim, "00000b")
+	victim = newTestMiner(t, sim, "00000c")
+	victim.Latency = func(*Miner, *Block) float64 { return 0 }
+	attacker.neighbors = []*Miner{honest, victim}
+	victim.neighbors = []*Miner{attacker}
+	sim.miners = Miners{attacker, honest, victim}
+	return sim, attacker, honest, victim
+}
+
+func TestEclipse_Feed(t *testing.T) {
+	sim, attacker, honest, victim := newTestEclipse(t, StrategySpec{Filter: true, Feed: true})
+
+	// The attacker's blocks go to the victim alone.
+	sim.sched.now = 10
+	attacker.mine()
+	a1 := attacker.head
+	if !victim.Blocks.has(a1) || honest.Blocks.has(a1) {
+		t.Fatalf("a1: victim has %v honest has %v", victim.Blocks.has(a1), honest.Blocks.has(a1))
+	}
+
+	// Honest blocks go to the honest neighbor alone, and the attacker keeps to its chain.
+	h1 := honestChild(sim, sim.genesis)
+	receive(attacker, h1)
+	if !honest.Blocks.has(h1) || victim.Blocks.has(h1) {
+		t.Fatalf("h1: honest has %v victim has %v", honest.Blocks.has(h1), victim.Blocks.has(h1))
+	}
+	if attacker.head != a1 {
+		t.Fatalf("attacker head %v want %v", attacker.head, a1)
+	}
+
+	// The victim's blocks on the fed chain stay on it.
+	sim.sched.now = 20
+	victim.mine()
+	v2 := victim.head
+	if v2.ph != a1.h || honest.Blocks.has(v2) {
+		t.Fatalf("v2: parent %s honest has %v", v2.ph, honest.Blocks.has(v2))
+	}
+	if attacker.head != v2 {
+		t.Errorf("attacker head %v want %v", attacker.head, v2)
+	}
+}
+
+func TestEclipse_VictimDelay(t *testing.T) {
+	sim, attacker, honest, victim := newTestEclipse(t, StrategySpec{VictimDelay: &DelayPolicy{Type: delayPolicyConstant, Seconds: 60}})
+
+	h1 := honestChild(sim, sim.genesis)
+	receive(attacker, h1)
+	if !honest.Blocks.has(h1) || victim.Blocks.has(h1) {
+		t.Fatalf("h1: honest has %v victim has %v", honest.Blocks.has(h1), victim.Blocks.has(h1))
+	}
+	for e := sim.sched.next(100); e != nil; e = sim.sched.next(100) {
+		if e.kind != eventDelivery {
+			continue
+		}
+		if e.miner != victim || e.at != 60 {
+			t.Errorf("delivery to %s at %v want %s at 60", e.miner.Address, e.at, victim.Address)
+		}
+		e.miner.handleEvent(e)
+	}
+	if victim.head != h1 {
+		t.Errorf("victim head %v want %v", victim.head, h1)
+	}
+}
+
+func TestGraph_Eclipse(t *testing.T) {
+	neighbors := func(g graph, a int) (in, out []int) {
+		for u := range g {
+			if g.has(u, a) {
+				in = append(in, u)
+			}
+		}
+		return in, g[a]
+	}
+	r := rand.New(rand.NewSource(1))
+
+	g, _ := fullGraph(TopologySpec{}, Params{}, 5, r)
+	if err := g.eclipse(0, 4, 1, r); err != nil {
+		t.Fatal(err)
+	}
+	if in, out := neighbors(g, 0); len(in) != 1 || in[0] != 4 || len(out) != 1 || out[0] != 4 {
+		t.Errorf("fully eclipsed: in %v out %v want [4] [4]", in, out)
+	}
+
+	// The attacker takes half of the victim's three other links, rounded.
+	g, _ = fullGraph(TopologySpec{}, Params{}, 5, r)
+	if err := g.eclipse(0, 4, 0.5, r); err != nil {
+		t.Fatal(err)
+	}
+	if in, out := neighbors(g, 0); len(in) != 2 || len(out) != 2 {
+		t.Errorf("half eclipsed: in %v out %v want two each", in, out)
+	}
+
+	// Miner 1 reaches the others through the victim only.
+	g = newGraph(3)
+	g.link(0, 1)
+	g.link(0, 2)
+	if err := g.eclipse(0, 2, 1, r); err == nil {
+		t.Errorf("disconnected graph %v", g)
+	}
+}
+
+// TestEclipse_Run checks that a victim fully eclipsed, and fed, wastes all its blocks, and one not eclipsed hardly any.
+func TestEclipse_Run(t *testing.T) {
+	rate := 0.5
+	for _, c := range []struct {
+		spec   StrategySpec
+		wasted func(float64) bool
+	}{
+		{StrategySpec{Filter: true, Feed: true}, func(w float64) bool { return w == 1 }},
+		{StrategySpec{Occupy: new(float64)}, func(w float64) bool { return w < 0.2 }},
+	} {
+		spec := c.spec
+		spec.Type, spec.Victim = strategyEclipse, "00ff00"
+		sc := &Scenario{
+			Name:     "eclipse",
+			Seed:     1,
+			Duration: Duration(time.Hour),
+			Network:  NetworkSpec{MinerNeighborRate: &rate},
+			Miners: []MinerSpec{
+				{Count: 6, HashrateDistribution: "equal", ConsensusAlgorithm: TD.String()},
+				{Name: "00ff00", Hashrate: 0.2, ConsensusAlgorithm: TD.String()},
+				{Name: "ff0000", Hashrate: 0.2, ConsensusAlgorithm: TD.String(), Strategy: &spec},
+			},
+		}
+		if err := sc.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		s := NewSimulation(sc.params())
+		err := s.run(runOptions{name: sc.Name, outDir: t.TempDir(), newMiners: sc.newMiners, skipPlots: true, logf: t.Logf})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := s.summary()
+		if !c.wasted(r.VictimWasted) {
+			t.Errorf("filter %v feed %v: victim wasted %0.3f", spec.Filter, spec.Feed, r.VictimWasted)
+		}
+		if spec.Feed && r.VictimDivergence == 0 {
+			t.Errorf("filter %v feed %v: victim did not diverge", spec.Filter, spec.Feed)
+		}
+	}
+}
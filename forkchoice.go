@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ForkChoice is a rule by which a miner chooses between two blocks for its head.
+type ForkChoice interface {
+	// Choose returns the block that miner m prefers of a, its incumbent head, and b, a block it has just received,
+	// and the reason for the choice, which is tallied in the miner's decision conditions.
+	// It returns a nil block when the rule can't tell the two apart.
+	// A rule that weighs the whole block tree, as GHOST does, may return another block of the tree instead.
+	Choose(m *Miner, a, b *Block) (*Block, string)
+}
+
+// ConsensusAlgorithm names a fork choice rule in the registry.
+type ConsensusAlgorithm string
+
+const (
+	None        ConsensusAlgorithm = "" // no rule: miners prefer the lower block, and break ties
+	TD          ConsensusAlgorithm = "TD"
+	TDTABS      ConsensusAlgorithm = "TDTABS"
+	TDTABS_step ConsensusAlgorithm = "TDTABS_step" // sequence-derived step algorithm for tabs numerator
+)
+
+// forkChoices are the fork choice rules a miner can be configured with, by name.
+var forkChoices = map[ConsensusAlgorithm]ForkChoice{
+	TD:          tdForkChoice{},
+	TDTABS:      tdtabsForkChoice{},
+	TDTABS_step: tdtabsForkChoice{}, // the step algorithm changes how blocks' TABS are made, not how they're compared
+	TimeDesc:    timeDescForkChoice{},
+	MESS:        messForkChoice{},
+	GHOST:       ghostForkChoice{},
+}
+
+// RegisterForkChoice adds fork choice rule fc to the registry, under name c,
+// for miners and scenarios to be configured with. Names can't be registered twice.
+func RegisterForkChoice(c ConsensusAlgorithm, fc ForkChoice) error {
+	if c == None || fc == nil {
+		return errors.New("a fork choice needs a name and a rule")
+	}
+	if _, ok := forkChoices[c]; ok {
+		return fmt.Errorf("fork choice %q is already registered", c)
+	}
+	forkChoices[c] = fc
+	return nil
+}
+
+func (c ConsensusAlgorithm) String() string {
+	if c == None {
+		return "None"
+	}
+	return string(c)
+}
+
+// ForkChoice returns the algorithm's rule, or nil for None.
+func (c ConsensusAlgorithm) ForkChoice() ForkChoice {
+	return forkChoices[c]
+}
+
+// parseConsensusAlgorithm returns the registered algorithm named s.
+func parseConsensusAlgorithm(s string) (ConsensusAlgorithm, error) {
+	c := ConsensusAlgorithm(s)
+	if _, ok := forkChoices[c]; !ok {
+		return None, fmt.Errorf("unknown consensus algorithm: %q (want one of %s)", s, strings.Join(consensusAlgorithmNames(), ", "))
+	}
+	return c, nil
+}
+
+func consensusAlgorithmNames() (names []string) {
+	for c := range forkChoices {
+		names = append(names, string(c))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tdForkChoice prefers the block with the greater total difficulty.
+type tdForkChoice struct{}
+
+func (tdForkChoice) Choose(m *Miner, a, b *Block) (*Block, string) {
+	switch a.td.Cmp(b.td) {
+	case 1:
+		return a, "consensus_score_high"
+	case -1:
+		return b, "consensus_score_high"
+	}
+	return nil, ""
+}
+
+// tdtabsForkChoice prefers the block with the greater total TD*TABS.
+type tdtabsForkChoice struct{}
+
+func (tdtabsForkChoice) Choose(m *Miner, a, b *Block) (*Block, string) {
+	switch a.ttdtabs.Cmp(b.ttdtabs) {
+	case 1:
+		return a, "consensus_score_high"
+	case -1:
+		return b, "consensus_score_high"
+	}
+	return nil, ""
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// lowHashForkChoice prefers the block with the lower hash, for testing registration.
+type lowHashForkChoice struct{}
+
+func (lowHashForkChoice) Choose(m *Miner, a, b *Block) (*Block, string) {
+	if a.h < b.h {
+		return a, "hash_low"
+	}
+	return b, "hash_low"
+}
+
+func TestForkChoice_Register(t *testing.T) {
+	const name ConsensusAlgorithm = "lowHash"
+	registered := make(map[ConsensusAlgorithm]ForkChoice, len(forkChoices))
+	for c, fc := range forkChoices {
+		registered[c] = fc
+	}
+	t.Cleanup(func() { forkChoices = registered })
+
+	if err := RegisterForkChoice(name, lowHashForkChoice{}); err != nil {
+		t.Fatal(err)
+	}
+	// Names are taken once, and None is no rule.
+	for _, c := range []ConsensusAlgorithm{name, TD, None} {
+		if err := RegisterForkChoice(c, lowHashForkChoice{}); err == nil {
+			t.Errorf("%q: registered", c)
+		}
+	}
+
+	algo, err := parseConsensusAlgorithm("lowHash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.ConsensusAlgorithm = algo
+
+	a := &Block{i: 1, td: big.NewInt(2), h: "0000000b"}
+	b := &Block{i: 1, td: big.NewInt(1), h: "0000000a"}
+	if got := m.arbitrateBlocks(a, b); got != b {
+		t.Errorf("chose %v want %v", got, b)
+	}
+	if got := m.decisionConditionTallies["hash_low"]; got != 1 {
+		t.Errorf("hash_low tally %d want 1", got)
+	}
+}
+
+func TestForkChoice_Builtin(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+
+	heavy := &Block{i: 1, td: big.NewInt(2), ttdtabs: big.NewInt(1), h: "0000000a"}
+	rich := &Block{i: 1, td: big.NewInt(1), ttdtabs: big.NewInt(2), h: "0000000b"}
+	for _, c := range []struct {
+		algo ConsensusAlgorithm
+		want *Block
+	}{
+		{TD, heavy},
+		{TDTABS, rich},
+		{TDTABS_step, rich},
+	} {
+		winner, reason := c.algo.ForkChoice().Choose(m, heavy, rich)
+		if winner != c.want || reason != "consensus_score_high" {
+			t.Errorf("%s: chose %v (%s) want %v", c.algo, winner, reason, c.want)
+		}
+		if winner, _ := c.algo.ForkChoice().Choose(m, heavy, heavy); winner != nil {
+			t.Errorf("%s: chose %v between equals", c.algo, winner)
+		}
+	}
+
+	if None.String() != "None" || None.ForkChoice() != nil {
+		t.Errorf("None: %q %v", None, None.ForkChoice())
+	}
+	if _, err := parseConsensusAlgorithm("lowHash"); err == nil || !strings.Contains(err.Error(), "TD, TDTABS, TDTABS_step") {
+		t.Errorf("lowHash: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import "math/big"
+
+// GHOST is the Greedy Heaviest Observed SubTree fork choice: at a fork, a miner follows the branch
+// whose subtree in its block tree holds the most difficulty, counting every block in it, uncles included,
+// rather than the branch whose single chain holds the most.
+const GHOST ConsensusAlgorithm = "GHOST"
+
+// ghostForkChoice walks down the block tree from the common ancestor of the two blocks, at each block following
+// the child, of all its children, whose subtree is the heaviest, and returns the block the walk ends at.
+// That is a or b, or, if a third branch outweighs both of theirs, the head of that branch.
+// Of subtrees of equal weight, the walk follows the one toward a or b, and between those two,
+// the one total difficulty prefers; if that ties too, the rule can't tell a and b apart.
+type ghostForkChoice struct{}
+
+func (ghostForkChoice) Choose(m *Miner, a, b *Block) (*Block, string) {
+	ancestor := m.Blocks.commonAncestor(a, b)
+	if ancestor == nil {
+		return tdForkChoice{}.Choose(m, a, b)
+	}
+	prefer, _ := tdForkChoice{}.Choose(m, a, b)
+
+	x := ancestor
+	for {
+		var next *Block
+		var weight *big.Int
+		for _, c := range m.Blocks[x.i+1] {
+			if c.ph != x.h {
+				continue
+			}
+			w := m.Blocks.subtreeWeight(c)
+			if next == nil {
+				next, weight = c, w
+				continue
+			}
+			switch w.Cmp(weight) {
+			case 1:
+				next, weight = c, w
+			case 0:
+				onA, onB := m.Blocks.ancestorAt(a, c.i) == c, m.Blocks.ancestorAt(b, c.i) == c
+				nextOnA, nextOnB := m.Blocks.ancestorAt(a, next.i) == next, m.Blocks.ancestorAt(b, next.i) == next
+				switch {
+				case (onA && nextOnB) || (onB && nextOnA):
+					if prefer == nil {
+						return nil, ""
+					}
+					if m.Blocks.ancestorAt(prefer, c.i) == c {
+						next = c
+					}
+				case (onA || onB) && !nextOnA && !nextOnB:
+					next = c
+				}
+			}
+		}
+		if next == nil {
+			return x, "subtree_heavy"
+		}
+		x = next
+	}
+}
+
+// ancestorAt returns b's ancestor (or b itself) at number i.
+func (bt BlockTree) ancestorAt(b *Block, i int64) *Block {
+	for b != nil && b.i > i {
+		b = bt.GetParent(b)
+	}
+	return b
+}
+
+// subtreeWeight is the total difficulty of b and all its descendants in the tree.
+func (bt BlockTree) subtreeWeight(b *Block) *big.Int {
+	weight := new(big.Int)
+	for stack := []*Block{b}; len(stack) > 0; {
+		x := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		weight.Add(weight, x.d)
+		for _, c := range bt[x.i+1] {
+			if c.ph == x.h {
+				stack = append(stack, c)
+			}
+		}
+	}
+	return weight
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+// TestGhostForkChoice checks that GHOST counts uncles: branch A has less chain difficulty than branch B,
+// but more in its subtree.
+func TestGhostForkChoice(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.ConsensusAlgorithm = GHOST
+
+	g := sim.genesis
+	a1 := addChild(m, g, 100, "000000a1")
+	a2 := addChild(m, a1, 100, "000000a2")
+	addChild(m, a1, 100, "000000u2") // an uncle of the A branch
+	b1 := addChild(m, g, 150, "000000b1")
+	b2 := addChild(m, b1, 120, "000000b2")
+
+	fc := GHOST.ForkChoice()
+	if winner, reason := fc.Choose(m, b2, a2); winner != a2 || reason != "subtree_heavy" {
+		t.Errorf("chose %s (%s) want %s", winner.h, reason, a2.h)
+	}
+	if winner, _ := TD.ForkChoice().Choose(m, b2, a2); winner != b2 {
+		t.Errorf("TD: chose %s want %s", winner.h, b2.h)
+	}
+	if winner, _ := fc.Choose(m, a2, a1); winner != a2 {
+		t.Errorf("ancestor: chose %s want %s", winner.h, a2.h)
+	}
+	if got, want := m.Blocks.subtreeWeight(g), addInt(g.d, 570); got.Cmp(want) != 0 {
+		t.Errorf("genesis subtree weight %d want %d", got, want)
+	}
+}
+
+// TestGhostForkChoice_ThirdBranch checks that GHOST weighs every child of the common ancestor, not just the two
+// branches it is asked to choose between: branch C outweighs both A and B, so its head wins.
+func TestGhostForkChoice_ThirdBranch(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.ConsensusAlgorithm = GHOST
+
+	g := sim.genesis
+	a2 := addChild(m, addChild(m, g, 100, "000000a1"), 100, "000000a2")
+	b1 := addChild(m, g, 150, "000000b1")
+	b2 := addChild(m, b1, 90, "000000b2")
+	c1 := addChild(m, g, 110, "000000c1")
+	c2 := addChild(m, c1, 70, "000000c2")
+	addChild(m, c1, 70, "00000c2u") // an uncle, seen after c2
+
+	fc := GHOST.ForkChoice()
+	for _, pair := range [][2]*Block{{a2, b2}, {b2, a2}, {a2, c2}} {
+		if winner, reason := fc.Choose(m, pair[0], pair[1]); winner != c2 || reason != "subtree_heavy" {
+			t.Errorf("%s vs %s: chose %s (%s) want %s", pair[0].h, pair[1].h, winner.h, reason, c2.h)
+		}
+	}
+
+	// The walk goes on past the block received, to the heaviest leaf.
+	if winner, _ := fc.Choose(m, g, c1); winner != c2 {
+		t.Errorf("chose %s want %s", winner.h, c2.h)
+	}
+	if got := m.arbitrateBlocks(a2, b2); got != c2 {
+		t.Errorf("arbitrated %s want %s", got.h, c2.h)
+	}
+}
@@ -11,6 +11,7 @@ require (
 	golang.org/x/image v0.0.0-20210628002857-a66eb6448b8d
 	gonum.org/v1/gonum v0.9.3
 	gonum.org/v1/plot v0.10.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+const (
+	latencyConstant  = "constant"
+	latencyLognormal = "lognormal"
+	latencyEmpirical = "empirical"
+)
+
+// LatencySpec declares the distribution of link latencies, in seconds.
+// Each link's latency is drawn once, when the network is built,
+// unless PerMessage is set. The zero value is the constant latencySeconds.
+type LatencySpec struct {
+	Type string `json:"type"` // constant (default), lognormal, empirical
+
+	// Sigma is the standard deviation of the log of lognormal latencies,
+	// whose median is latencySeconds.
+	Sigma float64 `json:"sigma"`
+
+	// Samples are measured latencies, which empirical latencies are drawn from uniformly.
+	Samples []float64 `json:"samples"`
+
+	// PerMessage draws a new latency for every block sent, rather than once per link.
+	PerMessage bool `json:"perMessage"`
+}
+
+func (l LatencySpec) typeName() string {
+	if l.Type == "" {
+		return latencyConstant
+	}
+	return l.Type
+}
+
+func (l LatencySpec) validate() error {
+	switch l.typeName() {
+	case latencyConstant, latencyLognormal:
+	case latencyEmpirical:
+		if len(l.Samples) == 0 {
+			return errors.New("empirical latency needs samples")
+		}
+	default:
+		return fmt.Errorf("type must be %q, %q or %q, got %q", latencyConstant, latencyLognormal, latencyEmpirical, l.Type)
+	}
+	if l.Sigma < 0 {
+		return fmt.Errorf("sigma must not be negative, got %v", l.Sigma)
+	}
+	for _, v := range l.Samples {
+		if v < 0 {
+			return fmt.Errorf("samples must not be negative, got %v", v)
+		}
+	}
+	return nil
+}
+
+// draw returns a latency from the distribution, whose constant (and median) value is seconds.
+func (l LatencySpec) draw(r *rand.Rand, seconds float64) float64 {
+	switch l.typeName() {
+	case latencyLognormal:
+		return seconds * math.Exp(l.Sigma*r.NormFloat64())
+	case latencyEmpirical:
+		return l.Samples[r.Intn(len(l.Samples))]
+	}
+	return seconds
+}
+
+// transferSeconds is the time it takes to send block b over a link of the simulation's bandwidth.
+func (p Params) transferSeconds(b *Block) float64 {
+	if p.BandwidthMbps <= 0 {
+		return 0
+	}
+	return float64(b.size) * 8 / (p.BandwidthMbps * 1e6)
+}
+
+// linkLatency returns a Miner.Latency for miner m's links to its neighbors,
+// with latencies drawn from the simulation's distribution around seconds.
+// A link between two miners has the same latency both ways.
+func (s *Simulation) linkLatency(m *Miner, seconds float64, drawn map[[2]int64]float64) func(to *Miner, b *Block) float64 {
+	if s.Latency.PerMessage {
+		return func(to *Miner, b *Block) float64 {
+			return s.Latency.draw(s.rand, seconds) + s.transferSeconds(b)
+		}
+	}
+	latencies := make(map[*Miner]float64, len(m.neighbors))
+	for _, n := range m.neighbors {
+		key := [2]int64{m.Index, n.Index}
+		if key[0] > key[1] {
+			key[0], key[1] = key[1], key[0]
+		}
+		l, ok := drawn[key]
+		if !ok {
+			l = s.Latency.draw(s.rand, seconds)
+			drawn[key] = l
+		}
+		latencies[n] = l
+	}
+	return func(to *Miner, b *Block) float64 {
+		return latencies[to] + s.transferSeconds(b)
+	}
+}
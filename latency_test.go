@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestLatencySpec_Draw(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	draws := make([]float64, 10001)
+	lognormal := LatencySpec{Type: latencyLognormal, Sigma: 1}
+	for i := range draws {
+		draws[i] = lognormal.draw(r, 2)
+	}
+	sort.Float64s(draws)
+	if median := draws[len(draws)/2]; median < 1.9 || median > 2.1 {
+		t.Errorf("lognormal median=%v want=2", median)
+	}
+
+	empirical := LatencySpec{Type: latencyEmpirical, Samples: []float64{0.1, 0.3}}
+	seen := map[float64]int{}
+	for i := 0; i < 100; i++ {
+		seen[empirical.draw(r, 2)]++
+	}
+	if len(seen) != 2 || seen[0.1] == 0 || seen[0.3] == 0 {
+		t.Errorf("empirical draws=%v", seen)
+	}
+
+	if got := (LatencySpec{}).draw(r, 2); got != 2 {
+		t.Errorf("constant=%v", got)
+	}
+}
+
+func TestLinkLatency(t *testing.T) {
+	p := DefaultParams()
+	p.Seed = 1
+	p.Latency = LatencySpec{Type: latencyLognormal, Sigma: 1}
+	p.BandwidthMbps = 8
+	s := NewSimulation(p)
+
+	miners := []*Miner{{Index: 0}, {Index: 1}, {Index: 2}}
+	for i, m := range miners {
+		for j, n := range miners {
+			if i != j {
+				m.neighbors = append(m.neighbors, n)
+			}
+		}
+	}
+	drawn := make(map[[2]int64]float64)
+	for _, m := range miners {
+		m.Latency = s.linkLatency(m, 1, drawn)
+	}
+
+	empty, full := &Block{}, &Block{size: 1_000_000}
+	for _, m := range miners {
+		for _, n := range m.neighbors {
+			if m.Latency(n, empty) != n.Latency(m, empty) {
+				t.Errorf("link %d-%d is not symmetric", m.Index, n.Index)
+			}
+			// A megabyte takes a second at 8Mbps.
+			if d := m.Latency(n, full) - m.Latency(n, empty); d < 0.999999 || d > 1.000001 {
+				t.Errorf("transfer=%v want=1", d)
+			}
+		}
+	}
+	if miners[0].Latency(miners[1], empty) == miners[0].Latency(miners[2], empty) {
+		t.Error("links have the same lognormal latency")
+	}
+}
@@ -4,44 +4,19 @@ import (
 	"fmt"
 	"image/color"
 	"math"
-	"math/rand"
+	"math/big"
+	"os"
 	"sort"
-	"time"
-
-	exprand "golang.org/x/exp/rand"
-	"gonum.org/v1/gonum/stat/distuv"
+	"strings"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 func main() {
-
-}
-
-// We'll use this for TAB score generation for each block.
-// A normal distribution may not be the best fit. TODO.
-var normalDist = distuv.Normal{
-	Mu:    float64(genesisBlockTABS),
-	Sigma: float64(genesisBlockTABS) / 4, // I just made this up. TODO.
-	Src:   exprand.NewSource(uint64(time.Now().UnixNano())),
+	if err := runCLI(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
-// Globals
-var ticksPerSecond int64 = 10
-var tickSamples = ticksPerSecond * int64((time.Hour * 6).Seconds())
-var networkLambda = (float64(1) / float64(13)) / float64(ticksPerSecond)
-var countMiners = int64(12)
-var minerNeighborRate float64 = 0.5 // 0.7
-var blockReward int64 = 3
-
-var latencySecondsDefault float64 = 1                  // 1.23               // 2.5
-var delaySecondsDefault float64 = 0                    // miner hesitancy to broadcast solution
-var receivePostponeSecondsDefault float64 = 100 / 1000 // 80 milliseconds, ish
-
-var tabsAdjustmentDenominator = int64(128) // int64(4096) <-- 4096 is the 'equilibrium' value, lower values prefer richer miners more (devaluing hashrate)
-const genesisBlockTABS int64 = 10_000      // tabs starting value
 const genesisDifficulty = 10_000_000_000
 
 // presumeMinerShareBalancePerBlockDenominator being 300 means that we assume that a miner's balance accounts for 1/300
@@ -49,21 +24,7 @@ const genesisDifficulty = 10_000_000_000
 // This value is used to set the starting balance for miners.
 const presumeMinerShareBalancePerBlockDenominator = 100
 
-var txPoolBlockTABs = make(map[int64]int64)
-
-var genesisBlock = &Block{
-	i:         0,
-	s:         0,
-	d:         genesisDifficulty,
-	td:        genesisDifficulty,
-	tabs:      genesisBlockTABS,
-	ttdtabs:   genesisBlockTABS * genesisDifficulty,
-	miner:     "00F00F",
-	delay:     Delay{},
-	h:         fmt.Sprintf("%08x", rand.Int63()),
-	ph:        "00000000",
-	canonical: true,
-}
+const receivePostponeSecondsDefault float64 = 100 / 1000 // 80 milliseconds, ish
 
 type Miners []*Miner
 
@@ -80,63 +41,82 @@ type minerEvent struct {
 	minerI int
 	i      int64
 	blocks Blocks
+
+	// frame, if set, asks the animation to save what it has drawn so far as the frame for that height.
+	frame int64
 }
 
 type Miner struct {
 	Index   int64
 	Address string
-	Blocks  BlockTree
+	Blocks  BlockTree // every block the miner has, canonical or not
+
+	// Chain is the miner's own canonical chain, from genesis to its head.
+	// Blocks are shared by all miners, so which of them are canonical is kept here, per miner.
+	Chain Chain
 
 	Hashrate      float64
-	HashesPerTick int64 // per tick
+	HashesPerTick int64 // hashing power; see discoveryRate
 	Balance       int64 // Wei
+	rewardCarry   int64 // reward sub-units not yet a whole Wei of Balance; see rewardSubunits
 	BalanceCap    int64 // Max Wei this miner will hold. Use 0 for no limit hold 'em.
 	CostPerBlock  int64 // cost to miner, expended after each block win (via tx on text block)
 
-	Latency func() int64
+	// Latency is the time, in seconds, block b takes to reach neighbor to.
+	// If it is not set when the simulation runs, it is drawn from the link model (see LatencySpec).
+	Latency func(to *Miner, b *Block) float64
 
-	// SendDelay represents a miner withholding a discovered puzzle solution, ie. "selfish mining"
-	SendDelay func(block *Block) int64
+	// Strategy, if set, is how the miner deviates from the protocol, eg. withholding the blocks it mines
+	// ("selfish mining"), or postponing the blocks it receives, to try to beat them with a higher TABS.
+	// Nil is honest.
+	Strategy Strategy
 
-	// ReceiveDelay represents a miner's reluctance to mine a latest-available head block.
-	// This could be because they are rich and try to produce a block with a higher TABS than a known low-TABS block.
-	// This is experimental; is this scheme profitable?
-	ReceiveDelay func(block *Block) int64
+	withheld map[string]float64 // by hash, when the miner sends blocks its strategy withheld; +Inf is private
+	switches map[string]*Block  // by hash, the block the strategy mines on once the miner has processed that block
 
 	ConsensusAlgorithm             ConsensusAlgorithm
 	ConsensusArbitrations          int
 	ConsensusObjectiveArbitrations int
 
-	// StrategySkipRandom tells the miner whether to skip the final coin toss arbitration.
-	// When true, the miner will prefer the first block available to it at that height.
-	StrategySkipRandom bool
+	// Attacker marks the adversary in an attack scenario, whose success the attack metrics measure.
+	Attacker bool
+
+	// Difficulty, if set, is the difficulty adjustment algorithm of the miner's blocks, in place of the simulation's.
+	Difficulty *DifficultySpec
+
+	// ActiveFrom and ActiveUntil bound the time the miner hashes, in seconds since genesis.
+	// Zero ActiveUntil is forever.
+	ActiveFrom, ActiveUntil float64
+
+	// TieBreaker is how the miner chooses between blocks its fork choice and their heights can't tell apart.
+	TieBreaker TieBreaker
+
+	gammaFavors map[string]bool // by selfish block hash, whether the miner mines on it in a tie; see gammaTie
+
+	sim *Simulation
 
 	reorgs                   map[int64]reorg
 	decisionConditionTallies map[string]int
 
 	head *Block
 
-	neighbors      []*Miner
-	receivedBlocks map[int64]Blocks
+	neighbors []*Miner
 
 	cord chan minerEvent
 
-	tick int64
-}
+	// discovery is the miner's next block discovery, on its current head.
+	discovery *event
 
-func getBlockDifficulty(parent *Block, uncles bool, interval int64) int64 {
-	x := interval / (9 * ticksPerSecond) // 9 SECONDS
-	y := 1 - x
-	if uncles {
-		y = 2 - x
-	}
-	if y < -99 {
-		y = -99
-	}
-	return int64(float64(parent.d) + (float64(y) / 2048 * float64(parent.d)))
+	// Orphans counts the blocks that arrived before their parent, and ParentFetches the parents requested for them.
+	Orphans       int
+	ParentFetches int
+
+	orphans     map[string][]orphan // by the missing parent's hash
+	fetching    map[string]bool     // parents requested and not yet arrived
+	orphanWaits []float64           // seconds each orphan waited for its parent
 }
 
-func getTABS(parentTabs, localTAB int64) (tabs int64) {
+func (s *Simulation) getTABS(parentTabs, localTAB int64) (tabs int64) {
 	scalarNumerator := int64(0)
 	if localTAB > parentTabs {
 		scalarNumerator = 1
@@ -144,12 +124,12 @@ func getTABS(parentTabs, localTAB int64) (tabs int64) {
 		scalarNumerator = -1
 	}
 
-	numerator := tabsAdjustmentDenominator + scalarNumerator // [127|128|129]/128, [4095|4096|4097]/4096
+	numerator := s.TabsAdjustmentDenominator + scalarNumerator // [127|128|129]/128, [4095|4096|4097]/4096
 
-	return int64(float64(parentTabs) * float64(numerator) / float64(tabsAdjustmentDenominator))
+	return int64(float64(parentTabs) * float64(numerator) / float64(s.TabsAdjustmentDenominator))
 }
 
-func getTABS_step(parentTabs, tabFallCount, localTAB int64) (tabs int64) {
+func (s *Simulation) getTABS_step(parentTabs, tabFallCount, localTAB int64) (tabs int64) {
 	scalarNumerator := int64(0)
 	if localTAB > parentTabs {
 		scalarNumerator = 1
@@ -157,70 +137,74 @@ func getTABS_step(parentTabs, tabFallCount, localTAB int64) (tabs int64) {
 		scalarNumerator = -1 - (tabFallCount / 9) // floor divide
 	}
 
-	numerator := tabsAdjustmentDenominator + scalarNumerator // [127|128|129]/128, [4095|4096|4097]/4096
+	numerator := s.TabsAdjustmentDenominator + scalarNumerator // [127|128|129]/128, [4095|4096|4097]/4096
 
-	return int64(float64(parentTabs) * float64(numerator) / float64(tabsAdjustmentDenominator))
+	return int64(float64(parentTabs) * float64(numerator) / float64(s.TabsAdjustmentDenominator))
 }
 
-func (m *Miner) doTick(s int64) {
-	m.tick = s
+// startMining (re)schedules the miner's next block discovery, on its head.
+// Solutions arrive as a Poisson process, so the time to the next one is exponentially distributed,
+// and (being memoryless) can be drawn afresh whenever the head, and so the difficulty, changes.
+func (m *Miner) startMining() {
+	rate := discoveryRate(m.HashesPerTick, m.head.d)
+	if rate <= 0 {
+		return
+	}
+	// The miner only hashes while active; solutions it would find later never come.
+	from := m.sim.sched.now
+	if from < m.ActiveFrom {
+		from = m.ActiveFrom
+	}
+	at := from + m.sim.rand.ExpFloat64()/rate
+	if m.ActiveUntil > 0 && at > m.ActiveUntil {
+		at = math.Inf(1)
+	}
+	if m.discovery == nil {
+		m.discovery = &event{at: at, kind: eventDiscovery, miner: m}
+		m.sim.sched.schedule(m.discovery)
+		return
+	}
+	m.sim.sched.reschedule(m.discovery, at)
+}
 
-	// Get tick-expired received blocks and process them.
-	for k, v := range m.receivedBlocks {
-		if m.tick >= k && /* future block inhibition -> */ m.tick+(15*ticksPerSecond) > k {
-			// process blocks in order they were received (per time slot)
-			for _, b := range v {
-				m.processBlock(b)
-			}
-			delete(m.receivedBlocks, k)
+func (m *Miner) handleEvent(e *event) {
+	switch e.kind {
+	case eventDiscovery:
+		m.mine()
+		if e.index < 0 {
+			// The miner kept its head, so mining on it goes on.
+			m.startMining()
 		}
+	case eventDelivery:
+		m.deliver(e.msg)
 	}
-
-	// Mine.
-	m.mineTick()
 }
 
-func fakeHashimoto(hashratePerTick, parentDifficulty, networkLambda float64) bool {
-	tickR := hashratePerTick / parentDifficulty * networkLambda
-	tickR = tickR / 2
-
-	// Do we solve it?
-	needle := rand.Float64()
-	trial := rand.Float64()
-
-	return math.Abs(trial-needle) <= tickR ||
-		math.Abs(trial-needle) >= 1-tickR
+// difficulty is the miner's difficulty adjustment algorithm.
+func (m *Miner) difficulty() DifficultyAlgorithm {
+	if m.Difficulty != nil {
+		return m.Difficulty.algorithm()
+	}
+	return m.sim.Difficulty.algorithm()
 }
 
-func (m *Miner) mineTick() {
+// mine makes a block on the miner's head, which it has just found a solution for.
+func (m *Miner) mine() {
 	parent := m.head
 
-	solved := fakeHashimoto(float64(m.HashesPerTick), float64(parent.d), networkLambda)
-	if !solved {
-		return
-	}
-
-	// Naively, the block tick (timestamp) is the miner's real tick.
-	s := m.tick
-
-	// But if the tickInterval allows multiple ticks / second,
-	// we need to enforce that the timestamp is a unit-second value.
-	s = s / ticksPerSecond // floor
-	s = s * ticksPerSecond // back to interval units
+	// The block timestamp is the current time, as a unit-second value
+	// (in tick units).
+	s := int64(m.sim.sched.now) * m.sim.TicksPerSecond
 
-	// In order for the block to be valid, the tick must be greater
+	// In order for the block to be valid, the timestamp must be greater
 	// than that of its parent.
-	if s == parent.s {
+	if s <= parent.s {
 		s = parent.s + 1
 	}
 
 	// Get a random value (from a normal distribution) as a representation of this block's TAB.
-	// This is a global value that, once set, all miners will use.
-	blockTxPoolTABs, ok := txPoolBlockTABs[parent.i+1]
-	if !ok {
-		blockTxPoolTABs = int64(normalDist.Rand())
-		txPoolBlockTABs[parent.i+1] = blockTxPoolTABs
-	}
+	// This is a simulation-wide value that, once set, all miners will use.
+	blockTxPoolTABs := m.sim.blockTxPoolTABs(parent.i + 1)
 	blockTAB := blockTxPoolTABs + m.Balance
 	tabChange := int64(0)
 	if blockTAB > parent.tabs {
@@ -236,57 +220,110 @@ func (m *Miner) mineTick() {
 		tabFalls = 0
 	}
 
-	// A naive model of uncle citations: block has uncles if any orphan blocks exist in our miner's record of the parent height
-	uncles := len(m.Blocks[parent.i-1]) > 1
-	blockDifficulty := getBlockDifficulty(parent /* interval: */, uncles, s-parent.s)
+	blockDifficulty := m.difficulty().Difficulty(m.sim, parent, s)
 
-	tabs := getTABS(parent.tabs, blockTAB)
+	tabs := m.sim.getTABS(parent.tabs, blockTAB)
 	if m.ConsensusAlgorithm == TDTABS_step {
-		tabs = getTABS_step(parent.tabs, tabFalls, blockTAB)
+		tabs = m.sim.getTABS_step(parent.tabs, tabFalls, blockTAB)
 	}
 
-	tdtabs := tabs * blockDifficulty
+	tdtabs := new(big.Int).Mul(big.NewInt(tabs), blockDifficulty)
 	b := &Block{
+		size:          m.sim.BlockSizeBytes,
 		i:             parent.i + 1,
 		s:             s, // miners are always honest about their timestamps
 		si:            s - parent.s,
 		d:             blockDifficulty,
-		td:            parent.td + blockDifficulty,
+		td:            new(big.Int).Add(parent.td, blockDifficulty),
 		tabsFallCount: tabFalls,
 		tabsCmp:       tabChange,
 		tabs:          tabs,
-		ttdtabs:       parent.ttdtabs + tdtabs,
+		ttdtabs:       new(big.Int).Add(parent.ttdtabs, tdtabs),
 		miner:         m.Address,
 		ph:            parent.h,
-		h:             fmt.Sprintf("%08x", rand.Int63()),
+		h:             m.sim.newBlockHash(),
+		uncles:        m.eligibleUncles(parent),
 	}
+	m.act(m.strategy().BlockMined(m.view(), b), b)
 	m.processBlock(b)
 	m.broadcastBlock(b)
 }
 
+// message is the delivery of a block to one neighbor.
+// Each delivery has its own delay, so that neither the sender's nor the recipient's
+// choices touch the (shared) block.
+type message struct {
+	block *Block
+	from  *Miner
+	delay Delay
+}
+
 func (m *Miner) broadcastBlock(b *Block) {
-	b.delay = Delay{
-		withhold: m.SendDelay(b),
-		material: m.Latency(),
-	}
 	for _, n := range m.neighbors {
-		n.receiveBlock(b)
+		w := m.sendDelay(b, n)
+		if math.IsInf(w, 1) {
+			continue
+		}
+		n.receiveBlock(message{
+			block: b,
+			from:  m,
+			delay: Delay{
+				withhold: w,
+				material: m.Latency(n, b),
+			},
+		})
 	}
 }
 
-func (m *Miner) receiveBlock(b *Block) {
-	if m.ReceiveDelay != nil {
-		b.delay.postpone = m.ReceiveDelay(b)
+// sendDelay is how long from now the miner's strategy has it hold b back from to: until its Withhold action's time,
+// or as a Relayer decides. It is +Inf while b is private, to to at least.
+func (m *Miner) sendDelay(b *Block, to *Miner) float64 {
+	withhold := 0.0
+	if until, ok := m.withheld[b.h]; ok {
+		withhold = math.Max(0, until-m.sim.sched.now) // +Inf if private
 	}
-	if d := b.delay.Total(); d > 0 {
-		if len(m.receivedBlocks[b.s+d]) > 0 {
-			m.receivedBlocks[b.s+d] = append(m.receivedBlocks[b.s+d], b)
-		} else {
-			m.receivedBlocks[b.s+d] = Blocks{b}
-		}
+	if relayer, ok := m.Strategy.(Relayer); ok {
+		return relayer.Relay(m.view(), b, to.Address, withhold)
+	}
+	return withhold
+}
+
+func (m *Miner) receiveBlock(msg message) {
+	// The delay runs from now, when the block reaches us (or, for our own blocks, when we mine it),
+	// so a block relayed over several hops accumulates the delay of each.
+	if d := msg.delay.Total(); d > 0 {
+		m.sim.sched.schedule(&event{
+			at:    m.sim.sched.now + d,
+			kind:  eventDelivery,
+			miner: m,
+			msg:   msg,
+		})
 		return
 	}
-	m.processBlock(b)
+	m.deliver(msg)
+}
+
+// deliver hands the miner the block in msg, which has reached it, unless its strategy postpones processing it.
+// A block whose parent the miner lacks waits as an orphan first (see acceptBlock): the strategy hears of it
+// once it can be processed, so that what the strategy makes of it is based on the miner's state then.
+func (m *Miner) deliver(msg message) {
+	if m.head != nil && m.Blocks.GetParent(msg.block) == nil {
+		m.addOrphan(msg)
+		return
+	}
+	if msg.delay.postpone == 0 {
+		if postpone := m.act(m.strategy().BlockReceived(m.view(), msg.block), msg.block); postpone > 0 {
+			msg.delay.postpone = postpone
+			m.sim.sched.schedule(&event{
+				at:    m.sim.sched.now + postpone,
+				kind:  eventDelivery,
+				miner: m,
+				msg:   msg,
+			})
+			return
+		}
+	}
+	m.acceptBlock(msg)
 }
 
 func (m *Miner) processBlock(b *Block) {
@@ -298,13 +335,22 @@ func (m *Miner) processBlock(b *Block) {
 	// Special case: init genesis block.
 	if m.head == nil {
 		m.head = b
-		m.head.canonical = true
+		m.Chain = Chain{b.i: b}
 		return
 	}
 
-	canon := m.arbitrateBlocks(m.head, b)
-	canon.canonical = true
-	m.setHead(canon)
+	head := m.head
+	parent, ok := m.switches[b.h]
+	delete(m.switches, b.h)
+	if ok && m.Blocks.has(parent) {
+		m.setHead(parent)
+	} else {
+		canon := m.arbitrateBlocks(m.head, b)
+		m.setHead(canon)
+	}
+	if m.head != head {
+		m.act(m.strategy().HeadChanged(m.view(), m.head), nil)
+	}
 }
 
 // arbitrateBlocks selects one canonical block from any two blocks.
@@ -319,23 +365,15 @@ func (m *Miner) arbitrateBlocks(a, b *Block) *Block {
 	m.ConsensusArbitrations++          // its what we do here
 	m.ConsensusObjectiveArbitrations++ // an assumption that will be undone (--) if it does not hold
 
-	decisionCondition := "consensus_score_high"
+	var decisionCondition string
 	defer func() {
 		m.decisionConditionTallies[decisionCondition]++
 	}()
 
-	if m.ConsensusAlgorithm == TD {
-		// TD arbitration
-		if a.td > b.td {
-			return a
-		} else if b.td > a.td {
-			return b
-		}
-	} else if m.ConsensusAlgorithm == TDTABS || m.ConsensusAlgorithm == TDTABS_step {
-		if (a.ttdtabs) > (b.ttdtabs) {
-			return a
-		} else if (b.ttdtabs) > (a.ttdtabs) {
-			return b
+	if fc := m.ConsensusAlgorithm.ForkChoice(); fc != nil {
+		if winner, reason := fc.Choose(m, a, b); winner != nil {
+			decisionCondition = reason
+			return winner
 		}
 	}
 
@@ -351,24 +389,27 @@ func (m *Miner) arbitrateBlocks(a, b *Block) *Block {
 	// objective.
 	m.ConsensusObjectiveArbitrations--
 
-	// Self-interest arbitration
-	decisionCondition = "miner_selfish"
-	if a.miner == m.Address && b.miner != m.Address {
-		return a
-	} else if b.miner == m.Address && a.miner != m.Address {
-		return b
+	if winner, ok := m.gammaTie(a, b); ok {
+		decisionCondition = "gamma"
+		return winner
 	}
 
-	// Coin toss
-	if m.StrategySkipRandom {
-		decisionCondition = "first_seen"
-		return a
-	}
-	decisionCondition = "random"
-	if rand.Float64() < 0.5 {
-		return a
+	var winner *Block
+	winner, decisionCondition = m.TieBreaker.breakTie(m, a, b)
+	return winner
+}
+
+// reward credits the miner with r reward sub-units, or debits it for a reward reorged out,
+// adding them to its balance as they make whole units. The carry left over is never negative,
+// so the balance never counts more than the miner has been paid.
+func (m *Miner) reward(r int64) {
+	m.rewardCarry += r
+	whole := m.rewardCarry / rewardSubunits
+	if m.rewardCarry%rewardSubunits < 0 {
+		whole--
 	}
-	return b
+	m.rewardCarry -= whole * rewardSubunits
+	m.balanceAdd(whole)
 }
 
 func (m *Miner) balanceAdd(i int64) {
@@ -378,143 +419,147 @@ func (m *Miner) balanceAdd(i int64) {
 	}
 }
 
+// setHead makes head the miner's head, and its ancestry the miner's canonical chain.
 func (m *Miner) setHead(head *Block) {
-
-	add, drop := 1, 0 // These will only be recorded if reorg is true. Otherwise noops.
-
-	addCanon := func(b *Block) {
-		b.canonical = true
-		if b.miner == m.Address {
-			m.balanceAdd(blockReward)
+	if head != m.head {
+		if head.ph == m.head.h {
+			m.addCanon(head)
+		} else {
+			m.reorg(head)
 		}
-		add++
+		m.head = head
+		m.startMining()
 	}
 
-	dropCanon := func(b *Block) {
-		if !b.canonical {
-			return
-		}
-		if b.miner == m.Address {
-			m.balanceAdd(-blockReward)
-		}
-		b.canonical = false
-		drop++
+	m.cord <- minerEvent{
+		minerI: int(m.Index),
+		i:      head.i,
+		blocks: m.Blocks[head.i],
 	}
+}
 
-	doReorg := m.head.h != head.ph
-	if doReorg {
+// reorg replaces the miner's canonical chain with head and its ancestry,
+// back to the common ancestor of the two, and records the change.
+func (m *Miner) reorg(head *Block) {
+	add, drop := 0, 0
 
-		// No block above the new head will be canonical.
-		for i := head.i + 1; ; i++ {
-			if len(m.Blocks[i]) == 0 {
-				// When reaching a height with no (zero) blocks,
-				// assume there are no greater heights with blocks either.
-				break
-			}
-			for _, b := range m.Blocks[i] {
-				dropCanon(b)
-			}
-		}
+	// No block above the new head will be canonical.
+	for i := head.i + 1; m.Chain[i] != nil; i++ {
+		m.dropCanon(m.Chain[i])
+		drop++
+	}
 
-		// All blocks at head height which are not the new head are not canonical.
-		for _, b := range m.Blocks[head.i] {
-			if b.h != head.h {
-				dropCanon(b)
-			}
+	// Iterate backwards from the head block,
+	// breaking when we find a common ancestor.
+	for b := head; b != nil && m.Chain[b.i] != b; b = m.Blocks.GetParent(b) {
+		if old := m.Chain[b.i]; old != nil {
+			m.dropCanon(old)
+			drop++
 		}
+		m.addCanon(b)
+		add++
+	}
 
-		// Iterate backwards from the parent of the head block
-		// breaking when we find a common ancestor.
-		for p := m.Blocks.GetParent(head); p != nil && !p.canonical; p = m.Blocks.GetParent(p) {
-			for _, v := range m.Blocks[p.i] {
-				dropCanon(v) // drop all from canon
-			}
-			addCanon(p) // add the one parent to canon
-		}
+	m.reorgs[head.i] = reorg{add, drop, head.miner}
 
-		m.reorgs[head.i] = reorg{add, drop}
+	// fmt.Println("Reorg!", m.Address, head.i, "add", add, "drop", drop)
+}
 
-		// fmt.Println("Reorg!", m.Address, head.i, "add", add, "drop", drop)
+func (m *Miner) addCanon(b *Block) {
+	m.Chain[b.i] = b
+	if r, _ := m.sim.rewards(b, m.Address); r != 0 {
+		m.reward(r)
 	}
+	if ds := m.sim.doubleSpender; ds != nil {
+		ds.canon(m, b, true)
+	}
+}
 
-	m.head = head
-	headI := head.i
-
-	addCanon(m.head)
-
-	m.cord <- minerEvent{
-		minerI: int(m.Index),
-		i:      headI,
-		blocks: m.Blocks[headI],
+func (m *Miner) dropCanon(b *Block) {
+	delete(m.Chain, b.i)
+	if r, _ := m.sim.rewards(b, m.Address); r != 0 {
+		m.reward(-r)
+	}
+	if ds := m.sim.doubleSpender; ds != nil {
+		ds.canon(m, b, false)
 	}
 }
 
 type reorg struct {
 	add, drop int
+	miner     string // of the new head
+}
+
+// depth is the number of canonical blocks the reorg replaced.
+func (r reorg) depth() int {
+	return r.drop
 }
 
 func (r reorg) magnitude() float64 {
 	return float64(r.add + r.drop)
 }
 
-func (m *Miner) reorgMagnitudes() (magnitudes []float64) {
-	for _, v := range m.reorgs {
-		magnitudes = append(magnitudes, v.magnitude())
+// reorgDepthMax is the depth of the miner's deepest reorg.
+func (m *Miner) reorgDepthMax() (depth int) {
+	for _, r := range m.reorgs {
+		if r.depth() > depth {
+			depth = r.depth()
+		}
 	}
-	return
+	return depth
 }
 
-type ConsensusAlgorithm int
-
-const (
-	None ConsensusAlgorithm = iota
-	TD
-	TDTABS
-	TDTABS_step // sequence-derived step algorithm for tabs numerator
-	TimeDesc    // FreshnessPreferred
-)
-
-func (c ConsensusAlgorithm) String() string {
-	switch c {
-	case TD:
-		return "TD"
-	case TDTABS:
-		return "TDTABS"
-	case TDTABS_step:
-		return "TDTABS_step"
-	// case TimeAsc:
-	// 	return "TimeAsc"
-	case TimeDesc:
-		return "TimeDesc"
+func (m *Miner) reorgMagnitudes() (magnitudes []float64) {
+	keys := make([]int64, 0, len(m.reorgs))
+	for k := range m.reorgs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, k := range keys {
+		magnitudes = append(magnitudes, m.reorgs[k].magnitude())
 	}
-	panic("impossible")
+	return
 }
 
 type Block struct {
-	i             int64  // H_i: number
-	s             int64  // H_s: timestamp
-	si            int64  // interval
-	d             int64  // H_d: difficulty
-	td            int64  // H_td: total difficulty
-	tabsFallCount int64  // scalar value tracking how many blocks in sequence have had falling TABS scores
-	tabsCmp       int64  // +/- TABS vs parent. Shortcut used for helping malicious miners figure out if they can try to beat a received block by postponing.
-	tabs          int64  // H_k: TAB synthesis
-	ttdtabs       int64  // H_k: TTABSConsensusScore, aka Total TD*TABS
-	miner         string // H_c: coinbase/etherbase/author/beneficiary
-	h             string // H_h: hash
-	ph            string // H_p: parent hash
-	canonical     bool
-
-	delay Delay
-}
-
+	i             int64    // H_i: number
+	s             int64    // H_s: timestamp
+	si            int64    // interval
+	d             *big.Int // H_d: difficulty
+	td            *big.Int // H_td: total difficulty
+	tabsFallCount int64    // scalar value tracking how many blocks in sequence have had falling TABS scores
+	tabsCmp       int64    // +/- TABS vs parent. Shortcut used for helping malicious miners figure out if they can try to beat a received block by postponing.
+	tabs          int64    // H_k: TAB synthesis
+	ttdtabs       *big.Int // H_k: TTABSConsensusScore, aka Total TD*TABS
+	miner         string   // H_c: coinbase/etherbase/author/beneficiary
+	h             string   // H_h: hash
+	ph            string   // H_p: parent hash
+	size          int64    // bytes
+	uncles        []*Block
+}
+
+// Difficulties and the scores summing them are big integers: totals overflow int64 in long runs,
+// and realistic difficulties overflow it within a few blocks.
+// A block's values are shared by every miner, so they are never modified in place.
+
+// bigFloat is x as a float64, for statistics and plots, which need not be exact.
+// Nil, as in a zero Block, is zero.
+func bigFloat(x *big.Int) float64 {
+	if x == nil {
+		return 0
+	}
+	f, _ := new(big.Float).SetInt(x).Float64()
+	return f
+}
+
+// Delay is the delay of a block's delivery to a miner. Its components are in seconds.
 type Delay struct {
-	withhold int64 // selfishly withhold. This is controlled by the mining miner.
-	postpone int64 // postpone processing to give self more time to mine last block. Controlled by the receiving miner.
-	material int64 // ohms
+	withhold float64 // selfishly withhold. This is controlled by the sending miner's strategy.
+	postpone float64 // postpone processing to give self more time to mine last block. Controlled by the receiving miner's strategy.
+	material float64 // ohms
 }
 
-func (d Delay) Total() int64 {
+func (d Delay) Total() float64 {
 	return d.withhold + d.postpone + d.material
 }
 
@@ -529,22 +574,40 @@ func NewBlockTree() BlockTree {
 	return BlockTree(make(map[int64]Blocks))
 }
 
+// numbers returns the block numbers in the tree, in ascending order.
+func (bt BlockTree) numbers() []int64 {
+	ns := make([]int64, 0, len(bt))
+	for n := range bt {
+		ns = append(ns, n)
+	}
+	sort.Slice(ns, func(i, j int) bool { return ns[i] < ns[j] })
+	return ns
+}
+
 func (bt BlockTree) String() string {
-	out := ""
+	return bt.format(nil)
+}
+
+// format formats the tree, marking whether each block is in chain c, if c is not nil.
+func (bt BlockTree) format(c Chain) string {
+	var out strings.Builder
 	for i := int64(0); i < int64(len(bt)); i++ {
 
-		out += fmt.Sprintf("n=%d ", i)
+		fmt.Fprintf(&out, "n=%d ", i)
 		for _, b := range bt[i] {
-			out += b.String()
+			out.WriteString(b.String())
+			if c != nil {
+				fmt.Fprintf(&out, "c=%v ", c[b.i] == b)
+			}
 		}
-		out += "\n"
+		out.WriteString("\n")
 	}
 
-	return out
+	return out.String()
 }
 
 func (b *Block) String() string {
-	return fmt.Sprintf("[i=%d s=%v(+%d) h=%s ph=%s d=%v td=%v c=%v]", b.i, b.s, b.si, b.h[:4], b.ph[:4], b.d, b.td, b.canonical)
+	return fmt.Sprintf("[i=%d s=%v(+%d) h=%s ph=%s d=%v td=%v]", b.i, b.s, b.si, b.h[:4], b.ph[:4], b.d, b.td)
 }
 
 func (bt BlockTree) AppendBlockByNumber(b *Block) (dupe bool) {
@@ -571,7 +634,8 @@ func (bt BlockTree) AppendBlockByNumber(b *Block) (dupe bool) {
 // It weirdly returns a float64 because it will be used with stats packages
 // that like []float64.
 func (bt BlockTree) Ks() (ks []float64) {
-	for _, v := range bt {
+	for _, i := range bt.numbers() {
+		v := bt[i]
 		if len(v) == 0 {
 			panic("how?")
 		}
@@ -580,43 +644,49 @@ func (bt BlockTree) Ks() (ks []float64) {
 	return ks
 }
 
-// Intervals returns ALL block intervals for a tree (whether canonical or not).
+// Chain is a canonical chain: its block at each number.
+type Chain map[int64]*Block
+
+// numbers returns the block numbers in the chain, in ascending order.
+func (c Chain) numbers() []int64 {
+	ns := make([]int64, 0, len(c))
+	for n := range c {
+		ns = append(ns, n)
+	}
+	sort.Slice(ns, func(i, j int) bool { return ns[i] < ns[j] })
+	return ns
+}
+
+// Intervals returns the block intervals of the chain.
 // Again, []float64 is used because its convenient in context.
-func (bt BlockTree) CanonicalIntervals() (intervals []float64) {
-	for _, v := range bt {
-		for _, b := range v {
-			if b.canonical {
-				intervals = append(intervals, float64(b.si))
-			}
-		}
+func (c Chain) Intervals() (intervals []float64) {
+	for _, i := range c.numbers() {
+		intervals = append(intervals, float64(c[i].si))
 	}
 	return intervals
 }
 
-func (bt BlockTree) CanonicalDifficulties() (difficulties []float64) {
-	for _, v := range bt {
-		for _, b := range v {
-			if !b.canonical {
-				continue
-			}
-			difficulties = append(difficulties, float64(b.d))
-		}
+func (c Chain) Difficulties() (difficulties []float64) {
+	for _, i := range c.numbers() {
+		difficulties = append(difficulties, bigFloat(c[i].d))
 	}
 	return difficulties
 }
 
-func (bt BlockTree) GetBlockByNumber(i int64) *Block {
-	for _, bl := range bt[i] {
-		if bl.canonical {
-			return bl
+// Wins returns the number of blocks in the chain mined by address.
+func (c Chain) Wins(address string) (wins int) {
+	for _, b := range c {
+		if b.miner == address {
+			wins++
 		}
 	}
-	return nil
+	return wins
 }
 
-func (bt BlockTree) GetSideBlocksByNumber(i int64) (sideBlocks Blocks) {
+// GetSideBlocksByNumber returns the blocks at number i which are not in chain c.
+func (bt BlockTree) GetSideBlocksByNumber(i int64, c Chain) (sideBlocks Blocks) {
 	for _, bl := range bt[i] {
-		if !bl.canonical {
+		if c[i] != bl {
 			sideBlocks = append(sideBlocks, bl)
 		}
 	}
@@ -655,6 +725,16 @@ func (bt BlockTree) GetParent(b *Block) (parent *Block) {
 	return nil
 }
 
+// has tells whether the tree has b.
+func (bt BlockTree) has(b *Block) bool {
+	for _, v := range bt[b.i] {
+		if v.h == b.h {
+			return true
+		}
+	}
+	return false
+}
+
 type minerResults struct {
 	ConsensusAlgorithm ConsensusAlgorithm
 	HashrateRel        float64
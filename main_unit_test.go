@@ -1,13 +1,17 @@
 package main
 
 import (
+	"math"
+	"math/big"
+	"reflect"
 	"testing"
 )
 
 // TestBlockTree_AppendBlock is a unit test.
 func TestBlockTree_AppendBlock(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
 	bt := NewBlockTree()
-	bt.AppendBlockByNumber(genesisBlock)
+	bt.AppendBlockByNumber(sim.genesis)
 	if len(bt[0]) == 0 {
 		t.Fatal("missing genesis at index=0")
 	}
@@ -18,3 +22,298 @@ func TestBlockTree_AppendBlock(t *testing.T) {
 		t.Fatal("missing block i=1 at index=1")
 	}
 }
+
+// TestBroadcastBlock_Deliveries checks that each delivery keeps its own delay:
+// a recipient's postponement, or a relay's withholding, must not leak into another delivery of the block.
+func TestBroadcastBlock_Deliveries(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	newMiner := func(address string, send, receive float64) *Miner {
+		m := newTestMiner(t, sim, address)
+		m.Strategy = &delayStrategy{
+			send:    &DelayPolicy{Type: delayPolicyConstant, Seconds: send},
+			receive: &DelayPolicy{Type: delayPolicyConstant, Seconds: receive},
+		}
+		return m
+	}
+	sender := newMiner("000001", 0, 0)
+	postponer := newMiner("000002", 0, 100)
+	relay := newMiner("000003", 50, 0)
+	other := newMiner("000004", 0, 0)
+
+	sender.neighbors = []*Miner{postponer, relay, other}
+	sender.Latency = func(to *Miner, _ *Block) float64 {
+		if to == relay {
+			return 0 // the relay processes (and relays) the block at once
+		}
+		return 1
+	}
+	relay.neighbors = []*Miner{other}
+	relay.Latency = func(*Miner, *Block) float64 { return 2 }
+
+	b := &Block{i: 1, s: 0, d: big.NewInt(genesisDifficulty), td: addInt(sim.genesis.td, genesisDifficulty), ph: sim.genesis.h, h: "0000000b", miner: sender.Address}
+	before := *b
+	sender.broadcastBlock(b)
+	if relay.head != b {
+		t.Error("relay did not process the block at once")
+	}
+
+	// The postponer's delivery comes round again when the postponement is up.
+	want := map[*Miner][]float64{
+		postponer: {1, 101},
+		other:     {1, 52},
+	}
+	got := map[*Miner][]float64{}
+	for e := sim.sched.next(200); e != nil; e = sim.sched.next(200) {
+		if e.kind != eventDelivery || e.msg.block != b {
+			continue
+		}
+		got[e.miner] = append(got[e.miner], e.at)
+		e.miner.handleEvent(e)
+		if e.miner == postponer && (postponer.head == b) != (e.at == 101) {
+			t.Errorf("postponer: head %v at %v", postponer.head, e.at)
+		}
+	}
+	for m, at := range want {
+		if !reflect.DeepEqual(got[m], at) {
+			t.Errorf("%s: deliveries at %v want %v", m.Address, got[m], at)
+		}
+	}
+	if !reflect.DeepEqual(*b, before) {
+		t.Errorf("block changed by delivery: %v -> %v", before, *b)
+	}
+}
+
+// TestRelay_AccumulatesDelay checks that each hop's delay runs from the time the relay receives the block.
+func TestRelay_AccumulatesDelay(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	a := newTestMiner(t, sim, "00000a")
+	b := newTestMiner(t, sim, "00000b")
+	c := newTestMiner(t, sim, "00000c")
+	a.neighbors = []*Miner{b}
+	b.neighbors = []*Miner{c}
+	for _, m := range []*Miner{a, b, c} {
+		m.Latency = func(*Miner, *Block) float64 { return 1 }
+	}
+
+	sim.sched.now = 10.5
+	blk := &Block{i: 1, s: 10 * sim.TicksPerSecond, d: big.NewInt(genesisDifficulty), td: addInt(sim.genesis.td, genesisDifficulty), ph: sim.genesis.h, h: "0000000b", miner: a.Address}
+	a.processBlock(blk)
+
+	arrivals := map[*Miner]float64{}
+	for e := sim.sched.next(100); e != nil; e = sim.sched.next(100) {
+		if e.kind != eventDelivery {
+			continue
+		}
+		if _, ok := arrivals[e.miner]; !ok {
+			arrivals[e.miner] = e.at
+		}
+		e.miner.handleEvent(e)
+	}
+	if got := arrivals[b]; got != 11.5 {
+		t.Errorf("b: arrival at %v want 11.5", got)
+	}
+	if got := arrivals[c]; got != 12.5 {
+		t.Errorf("c: arrival at %v want 12.5", got)
+	}
+}
+
+// TestAcceptBlock_Orphan checks that a block arriving before its parent waits for the parent,
+// which the miner fetches from the sender.
+func TestAcceptBlock_Orphan(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	a := newTestMiner(t, sim, "00000a")
+	b := newTestMiner(t, sim, "00000b")
+	a.Latency = func(*Miner, *Block) float64 { return 1 }
+
+	parent := &Block{i: 1, s: 1, d: big.NewInt(genesisDifficulty), td: addInt(sim.genesis.td, genesisDifficulty), ph: sim.genesis.h, h: "0000000p", miner: a.Address}
+	child := &Block{i: 2, s: 2, d: big.NewInt(genesisDifficulty), td: addInt(parent.td, genesisDifficulty), ph: parent.h, h: "0000000c", miner: a.Address}
+	a.processBlock(parent)
+	a.processBlock(child)
+	a.neighbors = []*Miner{b}
+
+	b.receiveBlock(message{block: child, from: a, delay: Delay{material: 1}})
+	for e := sim.sched.next(100); e != nil; e = sim.sched.next(100) {
+		if e.kind != eventDelivery {
+			continue
+		}
+		e.miner.handleEvent(e)
+		if e.at == 1 && len(b.Blocks[child.i]) != 0 {
+			t.Fatal("orphan processed before its parent")
+		}
+	}
+
+	if b.head != child {
+		t.Errorf("head %v want %v", b.head, child)
+	}
+	if b.Chain[parent.i] != parent {
+		t.Errorf("chain %v lacks parent", b.Chain)
+	}
+	if b.Orphans != 1 || b.ParentFetches != 1 {
+		t.Errorf("orphans=%d fetches=%d want 1 and 1", b.Orphans, b.ParentFetches)
+	}
+	// The child arrives at 1, and the parent after a round trip over the link.
+	if len(b.orphanWaits) != 1 || b.orphanWaits[0] != 2 {
+		t.Errorf("orphan waits %v want [2]", b.orphanWaits)
+	}
+	if len(b.orphans) != 0 || len(b.fetching) != 0 {
+		t.Errorf("orphans %v fetching %v left over", b.orphans, b.fetching)
+	}
+}
+
+// TestAcceptBlock_OrphanWithheldParent checks that a sender does not serve a parent its strategy keeps private,
+// and that the orphan connects once the sender releases the parent.
+func TestAcceptBlock_OrphanWithheldParent(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	a := newTestMiner(t, sim, "00000a")
+	b := newTestMiner(t, sim, "00000b")
+	a.Latency = func(*Miner, *Block) float64 { return 1 }
+
+	parent := &Block{i: 1, s: 1, d: big.NewInt(genesisDifficulty), td: addInt(sim.genesis.td, genesisDifficulty), ph: sim.genesis.h, h: "0000000p", miner: a.Address}
+	child := &Block{i: 2, s: 2, d: big.NewInt(genesisDifficulty), td: addInt(parent.td, genesisDifficulty), ph: parent.h, h: "0000000c", miner: a.Address}
+	a.processBlock(parent)
+	a.processBlock(child)
+	a.withheld = map[string]float64{parent.h: math.Inf(1)}
+	a.neighbors = []*Miner{b}
+
+	drain := func() {
+		for e := sim.sched.next(100); e != nil; e = sim.sched.next(100) {
+			if e.kind == eventDelivery {
+				e.miner.handleEvent(e)
+			}
+		}
+	}
+	b.receiveBlock(message{block: child, from: a, delay: Delay{material: 1}})
+	drain()
+	if b.Blocks.has(parent) || b.ParentFetches != 0 {
+		t.Fatalf("withheld parent served: has %v fetches %d", b.Blocks.has(parent), b.ParentFetches)
+	}
+
+	a.release(parent)
+	drain()
+	if b.head != child {
+		t.Errorf("after release: head %v want %v", b.head, child)
+	}
+}
+
+// addInt returns x+y, for building blocks' totals.
+func addInt(x *big.Int, y int64) *big.Int {
+	return new(big.Int).Add(x, big.NewInt(y))
+}
+
+// childBlock returns a block on parent, of difficulty d, a tick after it, with hash h.
+func childBlock(parent *Block, d int64, h string) *Block {
+	return &Block{i: parent.i + 1, s: parent.s + 1, d: big.NewInt(d), td: addInt(parent.td, d), ttdtabs: parent.ttdtabs, ph: parent.h, h: h}
+}
+
+// addChild adds childBlock(parent, d, h) to m's block tree, without processing it, and returns it.
+func addChild(m *Miner, parent *Block, d int64, h string) *Block {
+	b := childBlock(parent, d, h)
+	m.Blocks.AppendBlockByNumber(b)
+	return b
+}
+
+// newTestMiner returns a TD miner without neighbors, with the genesis block as head.
+func newTestMiner(t *testing.T, sim *Simulation, address string) *Miner {
+	events := make(chan minerEvent)
+	go func() {
+		for range events {
+		}
+	}()
+	t.Cleanup(func() { close(events) })
+
+	m := &Miner{
+		Address:                  address,
+		Blocks:                   NewBlockTree(),
+		ConsensusAlgorithm:       TD,
+		reorgs:                   make(map[int64]reorg),
+		decisionConditionTallies: make(map[string]int),
+		cord:                     events,
+		sim:                      sim,
+	}
+	m.processBlock(sim.genesis)
+	return m
+}
+
+// TestSetHead_OwnView checks that a miner's reorg changes only its own canonical chain and balance.
+func TestSetHead_OwnView(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	a := newTestMiner(t, sim, "00000a")
+	b := newTestMiner(t, sim, "00000b")
+
+	g := sim.genesis
+	a1 := &Block{i: 1, d: g.d, td: new(big.Int).Add(g.td, g.d), ph: g.h, h: "000000a1", miner: a.Address}
+	b1 := &Block{i: 1, d: addInt(g.d, 1), td: addInt(a1.td, 1), ph: g.h, h: "000000b1", miner: b.Address}
+	a2 := &Block{i: 2, d: g.d, td: new(big.Int).Add(b1.td, g.d), ph: b1.h, h: "000000a2", miner: a.Address}
+
+	a.processBlock(a1)
+	b.processBlock(a1)
+	if a.Balance != sim.BlockReward || a.Chain.Wins(a.Address) != 1 {
+		t.Fatalf("a: balance=%d wins=%d", a.Balance, a.Chain.Wins(a.Address))
+	}
+
+	// b1 has more difficulty, so a reorgs to it; b never sees it.
+	a.processBlock(b1)
+	if a.Chain[1] != b1 || a.head != b1 {
+		t.Fatalf("a: chain[1]=%v head=%v want %v", a.Chain[1], a.head, b1)
+	}
+	if b.Chain[1] != a1 || b.head != a1 {
+		t.Fatalf("b: chain[1]=%v head=%v want %v", b.Chain[1], b.head, a1)
+	}
+	if a.Balance != 0 {
+		t.Errorf("a: balance=%d after its block was reorged out", a.Balance)
+	}
+	if r := a.reorgs[1]; r != (reorg{add: 1, drop: 1, miner: b.Address}) {
+		t.Errorf("a: reorg=%+v", r)
+	}
+	if len(b.reorgs) != 0 {
+		t.Errorf("b: reorgs=%v", b.reorgs)
+	}
+
+	// A losing block changes nothing, and isn't a reorg.
+	b.processBlock(&Block{i: 1, d: addInt(g.d, -1), td: addInt(a1.td, -1), ph: g.h, h: "000000c1", miner: "00000c"})
+	if b.head != a1 || len(b.reorgs) != 0 || a.Balance != 0 {
+		t.Errorf("b: head=%v reorgs=%v a.balance=%d", b.head, b.reorgs, a.Balance)
+	}
+
+	a.processBlock(a2)
+	if got := a.Chain.Intervals(); len(got) != 3 || a.Chain.Wins(a.Address) != 1 || a.Balance != sim.BlockReward {
+		t.Errorf("a: chain=%v wins=%d balance=%d", a.Chain, a.Chain.Wins(a.Address), a.Balance)
+	}
+	if len(a.reorgs) != 1 {
+		t.Errorf("a: extending the head is not a reorg, reorgs=%v", a.reorgs)
+	}
+}
+
+// TestMine_Overflow mines a chain long enough that its total TD*TABS passes int64,
+// and checks that the scores stay exact and that the fork choice still prefers each block to its parent.
+func TestMine_Overflow(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.ConsensusAlgorithm = TDTABS
+
+	// Each block adds about genesisDifficulty*GenesisBlockTABS (1e14) to the score.
+	const blocks = 100000
+	td, ttdtabs := new(big.Int).Set(sim.genesis.td), new(big.Int).Set(sim.genesis.ttdtabs)
+	for n := 0; n < blocks; n++ {
+		sim.sched.now += targetBlockSeconds
+		m.mine()
+		td.Add(td, m.head.d)
+		ttdtabs.Add(ttdtabs, new(big.Int).Mul(big.NewInt(m.head.tabs), m.head.d))
+	}
+
+	if m.head.i != blocks {
+		t.Fatalf("head %d want %d", m.head.i, blocks)
+	}
+	if m.head.ttdtabs.IsInt64() {
+		t.Fatalf("ttdtabs %d fits int64; mine more blocks", m.head.ttdtabs)
+	}
+	if m.head.td.Cmp(td) != 0 || m.head.ttdtabs.Cmp(ttdtabs) != 0 {
+		t.Errorf("td=%d ttdtabs=%d want %d and %d", m.head.td, m.head.ttdtabs, td, ttdtabs)
+	}
+	for i := int64(1); i <= blocks; i++ {
+		b, parent := m.Chain[i], m.Chain[i-1]
+		if winner, _ := TDTABS.ForkChoice().Choose(m, parent, b); winner != b {
+			t.Fatalf("block %d: chose %v over %v", i, winner, b)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import "math/big"
+
+// MESS is Ethereum Classic's Modified Exponential Subjective Scoring (ECBP-1100), an artificial finality rule:
+// a miner reorganizes to a heavier chain only if, since their common ancestor, the proposed chain has gained
+// more difficulty than the local one by a factor that grows with the age of the ancestor.
+// The older the fork, the more an attacker's withheld chain has to outweigh the public one.
+const MESS ConsensusAlgorithm = "MESS"
+
+// The ECBP-1100 antigravity curve, in integer arithmetic as specified.
+const (
+	messCurveDenominator = 128
+	messXCap             = 25132 // floor(8000*pi): the fork age, in seconds, at which the curve flattens
+	messAmplitude        = 15
+	messHeight           = messCurveDenominator * messAmplitude * 2
+)
+
+// messCurveNumerator is the antigravity factor for a fork whose common ancestor is x seconds older than the local head,
+// over messCurveDenominator. It rises from 1 (x = 0) to 31 (x >= messXCap) along a cubic.
+func messCurveNumerator(x int64) int64 {
+	if x < 0 {
+		x = 0
+	}
+	if x > messXCap {
+		x = messXCap
+	}
+	return messCurveDenominator + (3*x*x-2*x*x*x/messXCap)*messHeight/(messXCap*messXCap)
+}
+
+// messReorgAllowed tells whether a miner with the local head may reorganize to proposed, whose common ancestor is ancestor.
+func (s *Simulation) messReorgAllowed(ancestor, local, proposed *Block) bool {
+	x := int64(s.seconds(local.s - ancestor.s))
+
+	// The subchains' difficulties, times the curve, can exceed 64 bits.
+	proposedTD := new(big.Int).Sub(proposed.td, ancestor.td)
+	localTD := new(big.Int).Sub(local.td, ancestor.td)
+	proposedTD.Mul(proposedTD, big.NewInt(messCurveDenominator))
+	localTD.Mul(localTD, big.NewInt(messCurveNumerator(x)))
+	return proposedTD.Cmp(localTD) >= 0
+}
+
+// messForkChoice prefers the block with the greater total difficulty,
+// unless choosing a proposed block over the incumbent is a reorg that MESS does not allow.
+type messForkChoice struct{}
+
+func (messForkChoice) Choose(m *Miner, a, b *Block) (*Block, string) {
+	winner, reason := tdForkChoice{}.Choose(m, a, b)
+	if winner != b {
+		return winner, reason
+	}
+	ancestor := m.Blocks.commonAncestor(a, b)
+	if ancestor == nil || ancestor.h == a.h {
+		// b extends the incumbent, which is no reorg.
+		return winner, reason
+	}
+	if !m.sim.messReorgAllowed(ancestor, a, b) {
+		return a, "antigravity"
+	}
+	return winner, reason
+}
+
+// commonAncestor returns the latest block that a and b both descend from (or are), or nil if the tree lacks their ancestry.
+func (bt BlockTree) commonAncestor(a, b *Block) *Block {
+	for a != nil && b != nil && a.h != b.h {
+		if a.i >= b.i {
+			a = bt.GetParent(a)
+		} else {
+			b = bt.GetParent(b)
+		}
+	}
+	if a == nil || b == nil {
+		return nil
+	}
+	return a
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestMessCurveNumerator(t *testing.T) {
+	for _, c := range []struct {
+		x, want int64
+	}{
+		{-1, 128},
+		{0, 128},
+		{3600, 341},
+		{messXCap / 2, 2048},
+		{messXCap, 31 * 128},
+		{28800, 31 * 128},
+	} {
+		if got := messCurveNumerator(c.x); got != c.want {
+			t.Errorf("x=%d: got %d want %d", c.x, got, c.want)
+		}
+	}
+}
+
+// TestMessForkChoice checks that a heavier chain forked an hour ago needs about 2.7 times
+// the local chain's difficulty since the fork, while a chain extending the head needs no more.
+func TestMessForkChoice(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.ConsensusAlgorithm = MESS
+
+	g := sim.genesis
+	hour := 3600 * sim.TicksPerSecond
+	local := addChild(m, g, 100, "0000000a")
+	local.s = g.s + hour
+	twice := addChild(m, g, 200, "0000000b")
+	thrice := addChild(m, g, 300, "0000000c")
+	next := addChild(m, local, 100, "0000000d")
+
+	fc := MESS.ForkChoice()
+	if winner, reason := fc.Choose(m, local, twice); winner != local || reason != "antigravity" {
+		t.Errorf("twice: chose %s (%s)", winner.h, reason)
+	}
+	if winner, _ := fc.Choose(m, local, thrice); winner != thrice {
+		t.Errorf("thrice: chose %s", winner.h)
+	}
+	if winner, _ := fc.Choose(m, local, next); winner != next {
+		t.Errorf("next: chose %s", winner.h)
+	}
+	if winner, _ := TD.ForkChoice().Choose(m, local, twice); winner != twice {
+		t.Errorf("TD: chose %s", winner.h)
+	}
+	if got := m.Blocks.commonAncestor(next, thrice); got != g {
+		t.Errorf("common ancestor %v want genesis", got)
+	}
+}
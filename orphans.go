@@ -0,0 +1,79 @@
+package main
+
+import "math"
+
+// A block can reach a miner before its parent does: its sender may have withheld the parent longer,
+// or the parent may have taken a slower path. The miner can't judge such a block without its ancestry,
+// so it holds the block as an orphan and asks the sender for the missing parent.
+// Once the parent is processed, the orphans waiting on it are delivered, and only then does the miner's strategy hear of them.
+
+// orphan is a block waiting for its parent.
+type orphan struct {
+	msg message // that delivered the block
+	at  float64 // seconds since genesis when it arrived
+}
+
+// acceptBlock processes the block delivered in msg, whose parent the miner has, and the orphans waiting on it.
+func (m *Miner) acceptBlock(msg message) {
+	m.processBlock(msg.block)
+	m.connectOrphans(msg.block)
+}
+
+// addOrphan holds the block delivered in msg until its parent arrives, and fetches the parent.
+func (m *Miner) addOrphan(msg message) {
+	b := msg.block
+	if m.orphans == nil {
+		m.orphans = make(map[string][]orphan)
+		m.fetching = make(map[string]bool)
+	}
+	for _, o := range m.orphans[b.ph] {
+		if o.msg.block.h == b.h {
+			return
+		}
+	}
+	m.orphans[b.ph] = append(m.orphans[b.ph], orphan{msg: msg, at: m.sim.sched.now})
+	m.Orphans++
+	m.fetchParent(msg)
+}
+
+// fetchParent asks the sender of msg for the parent of its block, unless the miner already has.
+// The sender has the parent, since miners only send blocks they have processed.
+// The request and then the parent each cross the link between the two.
+// The sender serves the parent no sooner than it would send it anyway: a parent its strategy keeps private,
+// from the miner at least, it does not serve at all, and the orphan waits until the parent is released.
+func (m *Miner) fetchParent(msg message) {
+	b := msg.block
+	if msg.from == nil || m.fetching[b.ph] {
+		return
+	}
+	parent := msg.from.Blocks.GetParent(b)
+	if parent == nil {
+		return
+	}
+	withhold := msg.from.sendDelay(parent, m)
+	if math.IsInf(withhold, 1) {
+		return
+	}
+	m.fetching[b.ph] = true
+	m.ParentFetches++
+
+	rtt := 2 * msg.from.Latency(m, parent)
+	m.sim.sched.schedule(&event{
+		at:    m.sim.sched.now + withhold + rtt,
+		kind:  eventDelivery,
+		miner: m,
+		msg:   message{block: parent, from: msg.from, delay: Delay{withhold: withhold, material: rtt}},
+	})
+}
+
+// connectOrphans delivers the orphans waiting on parent, which the miner has just processed,
+// and so, in turn, theirs. An orphan its strategy postpones keeps its own orphans waiting with it.
+func (m *Miner) connectOrphans(parent *Block) {
+	delete(m.fetching, parent.h)
+	orphans := m.orphans[parent.h]
+	delete(m.orphans, parent.h)
+	for _, o := range orphans {
+		m.orphanWaits = append(m.orphanWaits, m.sim.sched.now-o.at)
+		m.deliver(o.msg)
+	}
+}
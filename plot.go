@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/colornames"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// animation draws each miner's head blocks as they arrive on the miner event channel,
+// one column per miner and one row per block height.
+type animation struct {
+	dir        string
+	c          *gg.Context
+	columns    int
+	blockRowsN int
+
+	// blackRedForks draws uncontested blocks black and network forks red,
+	// instead of coloring blocks by their authoring miner.
+	blackRedForks bool
+
+	// err is the first error saving a frame; read it once draw has returned.
+	err error
+}
+
+func newAnimation(dir string, columns int) (*animation, error) {
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	c := gg.NewContext(800, 1200)
+
+	c.Push()
+	c.SetColor(colornames.White)
+	c.DrawRectangle(0, 0, float64(c.Width()), float64(c.Height()))
+	c.Fill()
+	c.Stroke()
+	c.Pop()
+
+	if err := c.SavePNG(filepath.Join(dir, "out.png")); err != nil {
+		return nil, err
+	}
+
+	return &animation{
+		dir:        dir,
+		c:          c,
+		columns:    columns,
+		blockRowsN: 150,
+	}, nil
+}
+
+func (a *animation) draw(minerEvents chan minerEvent, logf func(format string, args ...interface{})) {
+	c := a.c
+	marginX, marginY := c.Width()/100, c.Width()/100
+
+	c.Push() // unresolved state push
+
+	for event := range minerEvents {
+		if event.frame > 0 {
+			// Frames are saved here, in order with the drawing, which shares the context.
+			if err := a.saveFrame(event.frame); err != nil && a.err == nil {
+				a.err = err
+			}
+			continue
+		}
+		xW := (c.Width() - (2 * marginX)) / a.columns
+		x := event.minerI*xW + marginX
+
+		yH := (c.Height() - (2 * marginY)) / a.blockRowsN
+		y := int64(c.Height()) - (event.i%int64(a.blockRowsN))*int64(yH) + int64(marginY)
+
+		// Clear the row above on bottom-up overlap/overdraw.
+		c.Push()
+		c.SetColor(colornames.White)
+		c.DrawRectangle(0, float64(y-int64(yH*5)), float64(c.Width()), float64(yH*5))
+		c.Fill()
+		c.Stroke()
+		c.Pop()
+
+		nblocks := len(event.blocks)
+
+		// Or, more better, when you're interested in seeing forks,
+		// just don't print the uncontested blocks.
+		// if nblocks <= 1 {
+		// 	continue
+		// }
+
+		for ib, b := range event.blocks {
+			c.Push()
+			if a.blackRedForks {
+				// Black blocks = uncontested
+				// Red   blocks = network forks
+				clr := colornames.Black
+				if nblocks > 1 {
+					clr = colornames.Red
+				}
+				c.SetColor(clr)
+			} else {
+				// Get the block color from the block's authoring miner.
+				clr, err := ParseHexColor("#" + b.miner)
+				if err != nil {
+					logf("bad color %s %s", err.Error(), b.miner)
+					panic("test")
+				}
+				c.SetColor(clr)
+			}
+
+			realX := float64(x)
+			realX += float64(ib) * float64(xW/nblocks)
+
+			rectMargin := float64(0)
+
+			rectX, rectY := realX+rectMargin, float64(y)+rectMargin
+			rectW, rectH := float64(xW/nblocks)-(2*rectMargin), float64(yH)-(2*rectMargin)
+
+			c.DrawRectangle(rectX, rectY, rectW, rectH)
+			c.Fill()
+			c.Stroke()
+			c.Pop()
+		}
+	}
+}
+
+func (a *animation) saveFrame(height int64) error {
+	return a.c.SavePNG(filepath.Join(a.dir, fmt.Sprintf("%04d_f.png", height)))
+}
+
+// finish assembles the saved frames into a movie and a gif, then removes the frames.
+// If ffmpeg is not installed the frames are left in place.
+func (a *animation) finish(logf func(format string, args ...interface{})) error {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		logf("ffmpeg not found, skipping movie: %v", err)
+		return nil
+	}
+
+	/*
+		https://superuser.com/questions/249101/how-can-i-combine-30-000-images-into-a-timelapse-movie
+
+		ffmpeg -f image2 -r 1/5 -i img%03d.png -c:v libx264 -pix_fmt yuv420p out.mp4
+		ffmpeg -f image2 -pattern_type glob -i 'time-lapse-files/*.JPG' …
+
+	*/
+	logf("Making movie...")
+	movieCmd := exec.Command(ffmpeg,
+		"-f", "image2",
+		"-r", "20/1", // 10 images / 1 second (Hz)
+		// "-vframes", fmt.Sprintf("%d", lastHighBlock),
+		"-pattern_type", "glob",
+		"-i", filepath.Join(a.dir, "*.png"),
+		"-c:v", "libx264",
+		"-pix_fmt", "yuv420p",
+		filepath.Join(a.dir, "out.mp4"),
+	)
+	if err := movieCmd.Run(); err != nil {
+		return err
+	}
+
+	/*
+		https://askubuntu.com/questions/648603/how-to-create-an-animated-gif-from-mp4-video-via-command-line
+
+		ffmpeg \
+		  -i opengl-rotating-triangle.mp4 \
+		  -r 15 \
+		  -vf scale=512:-1 \
+		  -ss 00:00:03 -to 00:00:06 \
+		  opengl-rotating-triangle.gif
+	*/
+	logf("Making gif...")
+	gifCmd := exec.Command(ffmpeg,
+		"-i", filepath.Join(a.dir, "out.mp4"),
+		// "-r", "10", // Hz value
+		"-r", "20", // Hz value
+		"-vf", "scale=512:-1",
+		filepath.Join(a.dir, "out.gif"),
+	)
+	if err := gifCmd.Run(); err != nil {
+		return err
+	}
+
+	animSlides, err := filepath.Glob(filepath.Join(a.dir, "*.png"))
+	if err != nil {
+		return err
+	}
+	for _, f := range animSlides {
+		// 			imgBaseName := fmt.Sprintf("%04d_f.png", nextHighBlock)
+		base := filepath.Base(f)
+		numStr := base[:4]
+		if i, err := strconv.Atoi(numStr); err != nil && i%a.blockRowsN == 0 {
+			continue
+		} else if err != nil {
+			logf("%v", err)
+		}
+		os.Remove(f)
+	}
+	return nil
+}
+
+// plotAll writes the summary plots for a finished run to outDir.
+func plotAll(outDir string, s *Simulation, miners []*Miner) {
+
+	plotIntervals := func() {
+		filename := filepath.Join(outDir, "sample_intervals.png")
+		p := plot.New()
+
+		buckets := map[int]int{}
+		for _, blocks := range miners[0].Blocks {
+			for _, b := range blocks {
+				buckets[int(b.si/s.TicksPerSecond)]++
+			}
+		}
+		data := plotter.XYs{}
+		for k, v := range buckets {
+			data = append(data, plotter.XY{X: float64(k), Y: float64(v)})
+		}
+		hist, err := plotter.NewHistogram(data, len(buckets))
+		if err != nil {
+			panic(err)
+		}
+		p.Add(hist)
+		p.Save(800, 300, filename)
+	}
+	plotIntervals()
+
+	plotDifficulty := func() {
+		filename := filepath.Join(outDir, "block_difficulties.png")
+		p := plot.New()
+
+		data := plotter.XYs{}
+		for k, v := range miners[0].Blocks {
+			data = append(data, plotter.XY{X: float64(k), Y: bigFloat(v[0].d)})
+		}
+		scatter, err := plotter.NewScatter(data)
+		if err != nil {
+			panic(err)
+		}
+		scatter.Radius = 1
+		scatter.Shape = draw.CircleGlyph{}
+		p.Add(scatter)
+		p.Y.Min = bigFloat(s.genesis.d) / 2 // low enough for sense of scale of variance
+		p.Save(800, 300, filename)
+	}
+	plotDifficulty()
+
+	plotTABS := func() {
+		filename := filepath.Join(outDir, "block_tabs.png")
+		p := plot.New()
+
+		data := plotter.XYs{}
+		for k, v := range miners[0].Blocks {
+			data = append(data, plotter.XY{X: float64(k), Y: float64(v[0].tabs)})
+		}
+		scatter, err := plotter.NewScatter(data)
+		if err != nil {
+			panic(err)
+		}
+		scatter.Radius = 1
+		scatter.Shape = draw.CircleGlyph{}
+		p.Add(scatter)
+		p.Y.Min = float64(s.genesis.tabs) / 2 // low enough for sense of scale of variance
+		p.Save(800, 300, filename)
+	}
+	plotTABS()
+
+	plotMinerTDs := func() {
+		filename := filepath.Join(outDir, "miner_tds.png")
+		p := plot.New()
+
+		for _, m := range miners {
+			data := plotter.XYs{}
+			for k, b := range m.Chain {
+				data = append(data, plotter.XY{X: float64(k), Y: bigFloat(b.td)})
+			}
+
+			scatter, err := plotter.NewScatter(data)
+			if err != nil {
+				panic(err)
+			}
+			scatter.Radius = 1
+			scatter.Shape = draw.CircleGlyph{}
+			scatter.Color, _ = ParseHexColor("#" + m.Address)
+			p.Add(scatter)
+			p.Legend.Add(m.Address, scatter)
+		}
+
+		// p.Y.Min = float64(s.genesis.td)
+		p.Save(800, 300, filename)
+	}
+	plotMinerTDs()
+
+	plotMinerTDTABS := func() {
+		filename := filepath.Join(outDir, "miner_ttdtabs_ts.png")
+		p := plot.New()
+		p.Title.Text = "Miner TD*TABS Values Over Timestamp"
+
+		for _, m := range miners {
+			data := plotter.XYs{}
+			for _, b := range m.Chain {
+				data = append(data, plotter.XY{X: float64(b.s), Y: bigFloat(b.ttdtabs)})
+			}
+
+			scatter, err := plotter.NewScatter(data)
+			if err != nil {
+				panic(err)
+			}
+			scatter.Radius = 1
+			scatter.Shape = draw.CircleGlyph{}
+			scatter.Color, _ = ParseHexColor("#" + m.Address)
+			p.Add(scatter)
+			p.Legend.Add(m.Address, scatter)
+		}
+
+		// p.Y.Min = float64(s.genesis.td)
+		p.Save(800, 300, filename)
+	}
+	plotMinerTDTABS()
+
+	plotMinerTDTABSBlockN := func() {
+		filename := filepath.Join(outDir, "miner_ttdtabs_blockn.png")
+		p := plot.New()
+		p.Title.Text = "Miner TD*TABS Values Over Block Height"
+
+		for _, m := range miners {
+			data := plotter.XYs{}
+			for blockHeight, b := range m.Chain {
+				data = append(data, plotter.XY{X: float64(blockHeight), Y: bigFloat(b.ttdtabs)})
+			}
+
+			scatter, err := plotter.NewScatter(data)
+			if err != nil {
+				panic(err)
+			}
+			scatter.Radius = 1
+			scatter.Shape = draw.CircleGlyph{}
+			scatter.Color, _ = ParseHexColor("#" + m.Address)
+			p.Add(scatter)
+			p.Legend.Add(m.Address, scatter)
+		}
+
+		// p.Y.Min = float64(s.genesis.td)
+		p.Save(800, 300, filename)
+	}
+	plotMinerTDTABSBlockN()
+
+	plotMinerReorgs := func() {
+
+		filename := filepath.Join(outDir, "miner_reorgs.png")
+		p := plot.New()
+
+		adds := plotter.XYs{}
+		drops := plotter.XYs{}
+		for i, m := range miners {
+			i += 1
+			centerMinerInterval := float64(i)
+			for k, v := range m.reorgs {
+				adds = append(adds, plotter.XY{X: float64(k), Y: float64(centerMinerInterval + float64(v.add)/20)})
+				drops = append(drops, plotter.XY{X: float64(k), Y: float64(centerMinerInterval - float64(v.drop)/20)})
+			}
+
+			addScatter, err := plotter.NewScatter(adds)
+			if err != nil {
+				panic(err)
+			}
+			addScatter.Radius = 1
+			addScatter.Shape = draw.CircleGlyph{}
+			addScatter.Color = color.RGBA{R: 1, G: 255, B: 1, A: 255}
+			p.Add(addScatter)
+
+			dropScatter, err := plotter.NewScatter(drops)
+			if err != nil {
+				panic(err)
+			}
+			dropScatter.Radius = 1
+			dropScatter.Shape = draw.CircleGlyph{}
+			dropScatter.Color = color.RGBA{R: 255, G: 1, B: 1, A: 255}
+			p.Add(dropScatter)
+		}
+
+		p.Y.Max = float64(len(miners) + 1)
+
+		// p.Y.Min = float64(s.genesis.td)
+		p.Save(800, vg.Length(float64(len(miners)+1)*20), filename)
+	}
+	plotMinerReorgs()
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	colorful "github.com/lucasb-eyer/go-colorful"
+	"github.com/mazznoer/colorgrad"
+	"github.com/montanaflynn/stats"
+)
+
+// runOptions configures a single simulation run.
+type runOptions struct {
+	name   string
+	outDir string
+
+	// minerMutation is applied to every miner after it is built,
+	// and is how experiments set consensus algorithms and strategies.
+	minerMutation func(m *Miner)
+
+	// newMiners, if set, builds the miners instead of the default longtail set.
+	// minerMutation is not applied to them.
+	newMiners func(s *Simulation, minerEvents chan minerEvent) []*Miner
+
+	// attacker installs a rich, high-hashrate miner which withholds its blocks for 8 hours.
+	attacker bool
+
+	// skipPlots skips the summary plots, eg. for sweeps where only the stats are wanted.
+	skipPlots bool
+
+	// animate writes a PNG frame per new block height, and (if ffmpeg is available)
+	// assembles them into a movie and gif.
+	animate bool
+
+	logf func(format string, args ...interface{})
+}
+
+func (s *Simulation) minersNormal(minerEvents chan minerEvent, mut func(m *Miner)) (miners []*Miner) {
+
+	hashrates := generateMinerHashrates(HashrateDistLongtail, int(s.CountMiners))
+	deriveMinerRelativeDifficultyHashes := func(genesisD *big.Int, r float64) int64 {
+		return int64(bigFloat(genesisD) * r)
+	}
+
+	// We use relative hashrate as a proxy for balance;
+	// more mining capital :: more currency capital.
+	deriveMinerStartingBalance := func(genesisTABS int64, minerHashrate float64) int64 {
+		// supply := genesisTABS * countMiners
+		supply := genesisTABS / presumeMinerShareBalancePerBlockDenominator * s.CountMiners
+		return int64((float64(supply) * minerHashrate))
+	}
+
+	lastColor := colorful.Color{}
+	grad := colorgrad.Viridis()
+
+	for i := int64(0); i < s.CountMiners; i++ {
+
+		// set up their starting view of the chain
+		bt := NewBlockTree()
+		bt.AppendBlockByNumber(s.genesis)
+
+		// set up the miner
+
+		// minerStartingBalance := deriveMinerStartingBalance(s.genesis.tabs, hashrates[i])
+		minerStartingBalance := deriveMinerStartingBalance(s.genesis.tabs, hashrates[s.CountMiners-1-i]) // backwards
+		hashes := deriveMinerRelativeDifficultyHashes(s.genesis.d, hashrates[i])
+
+		clr := grad.At(1 - (hashrates[i] * (1 / hashrates[0])))
+		if clr == lastColor {
+			// Make sure colors (names) are unique.
+			clr.R++
+		}
+		lastColor = clr
+		minerName := clr.Hex()[1:]
+
+		// format := "#%02x%02x%02x"
+		// minerName := fmt.Sprintf("%02x%02x%02x", clr.R, clr.G, clr.B)
+
+		m := &Miner{
+			// ConsensusAlgorithm: TDTABS,
+			// ConsensusAlgorithm: TD,
+			Index:         i,
+			Address:       minerName, // avoid collisions
+			Hashrate:      hashrates[i],
+			HashesPerTick: hashes,
+			Balance:       minerStartingBalance,
+			// BalanceCap:               minerStartingBalance,
+			Blocks:                   bt,
+			head:                     nil,
+			neighbors:                []*Miner{},
+			reorgs:                   make(map[int64]reorg),
+			decisionConditionTallies: make(map[string]int),
+			cord:                     minerEvents,
+			sim:                      s,
+			Strategy:                 s.defaultStrategy(),
+		}
+
+		mut(m)
+
+		m.processBlock(s.genesis) // sets head to genesis
+		miners = append(miners, m)
+	}
+
+	return miners
+}
+
+// newAttackMiner creates a miner which will NOT publish their blocks.
+// They will be rich.
+func (s *Simulation) newAttackMiner(index int64, minerEvents chan minerEvent) *Miner {
+	// attack: 1606651707293287461
+	// defend:  203433894893418879
+	attackerMinerBt := NewBlockTree()
+	attackerMinerBt.AppendBlockByNumber(s.genesis)
+	return &Miner{
+		Index:         index,
+		Address:       "ff0000",
+		Attacker:      true,
+		Blocks:        attackerMinerBt,
+		Hashrate:      0.9,
+		HashesPerTick: int64(float64(genesisDifficulty) * 0.9),
+		Balance:       s.GenesisBlockTABS * 11 / 10, // rich enough to always win TABS
+		BalanceCap:    0,
+		CostPerBlock:  0,
+		Strategy: &delayStrategy{
+			send:    &DelayPolicy{Type: delayPolicyConstant, Seconds: 60 * 60 * 8}, // 8 hour send delay
+			receive: &DelayPolicy{Type: delayPolicyConstant, Seconds: 60 * 60 * 8}, // 8 hour receive delay
+		},
+		ConsensusAlgorithm:             None,
+		ConsensusArbitrations:          0,
+		ConsensusObjectiveArbitrations: 0,
+		head:                           nil,
+		neighbors:                      []*Miner{},
+		reorgs:                         make(map[int64]reorg),
+		decisionConditionTallies:       make(map[string]int),
+		cord:                           minerEvents,
+		sim:                            s,
+	}
+}
+
+// run builds the miners, runs the event loop, and writes
+// per-miner stats, block trees and plots to opts.outDir.
+func (s *Simulation) run(opts runOptions) error {
+	logf := opts.logf
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+	mut := opts.minerMutation
+	if mut == nil {
+		mut = func(*Miner) {}
+	}
+
+	logf("Running %s seed=%d", opts.name, s.Seed)
+
+	outDir := opts.outDir
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return err
+	}
+	// Record the seed so that the run can be reproduced.
+	if err := ioutil.WriteFile(filepath.Join(outDir, "seed"), []byte(fmt.Sprintf("%d\n", s.Seed)), os.ModePerm); err != nil {
+		return err
+	}
+
+	minerEvents := make(chan minerEvent)
+
+	var miners []*Miner
+	if opts.newMiners != nil {
+		miners = opts.newMiners(s, minerEvents)
+	} else {
+		miners = s.minersNormal(minerEvents, mut)
+	}
+
+	if opts.attacker {
+		attackMiner := s.newAttackMiner(int64(len(miners)), minerEvents)
+		mut(attackMiner)
+		attackMiner.processBlock(s.genesis)
+		miners = append(miners, attackMiner)
+	}
+	s.miners = miners
+	for _, m := range miners {
+		if ds, ok := m.Strategy.(*doubleSpendStrategy); ok {
+			s.doubleSpender = ds
+		}
+	}
+
+	var anim *animation
+	if opts.animate {
+		var err error
+		anim, err = newAnimation(filepath.Join(outDir, "anim"), len(miners))
+		if err != nil {
+			return err
+		}
+	}
+	eventsDone := make(chan struct{})
+	go func() {
+		defer close(eventsDone)
+		if anim != nil {
+			anim.draw(minerEvents, logf)
+			return
+		}
+		for range minerEvents {
+		}
+	}()
+	// Once the miners are done, close their event channel, and wait for its reader to finish.
+	var stopOnce sync.Once
+	stopEvents := func() {
+		stopOnce.Do(func() {
+			close(minerEvents)
+			<-eventsDone
+		})
+	}
+	defer stopEvents()
+
+	g, err := s.topology(len(miners))
+	if err != nil {
+		return err
+	}
+	for i, m := range miners {
+		e, ok := m.Strategy.(*eclipseStrategy)
+		if !ok {
+			continue
+		}
+		for j, victim := range miners {
+			if victim.Address == e.victim {
+				if err := g.eclipse(j, i, e.occupy, s.rand); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for i, m := range miners {
+		for _, j := range g[i] {
+			m.neighbors = append(m.neighbors, miners[j])
+		}
+	}
+	drawn := make(map[[2]int64]float64)
+	for _, m := range miners {
+		if m.Latency == nil {
+			m.Latency = s.linkLatency(m, s.LatencySeconds, drawn)
+		}
+	}
+	topologyLog := fmt.Sprintf("topology=%s %s\n", s.Topology.typeName(), g.metrics())
+	logf("%s", topologyLog)
+	if err := ioutil.WriteFile(filepath.Join(outDir, "topology"), []byte(topologyLog+g.edgeList()), os.ModePerm); err != nil {
+		return err
+	}
+
+	for _, m := range miners {
+		m.startMining()
+	}
+
+	lastHighBlock := int64(0)
+	end := s.seconds(s.TickSamples)
+	clock := s.sched.now
+	for e := s.sched.next(end); e != nil; e = s.sched.next(end) {
+		if e.at > clock {
+			clock = e.at
+			for _, m := range miners {
+				m.tick()
+			}
+		}
+		e.miner.handleEvent(e)
+
+		if anim == nil {
+			continue
+		}
+		nextHighBlock := Miners(miners).headMax()
+		if nextHighBlock > lastHighBlock {
+			minerEvents <- minerEvent{frame: nextHighBlock}
+			lastHighBlock = nextHighBlock
+		}
+
+		// TODO: measure network graphs? eg. bifurcation tally?
+	}
+	stopEvents()
+	if anim != nil && anim.err != nil {
+		return fmt.Errorf("save png: %w", anim.err)
+	}
+
+	logf("RESULTS %s", opts.name)
+
+	for i, m := range miners {
+		minerLog := m.resultsLog()
+
+		logf("%s", minerLog)
+
+		// Log the stats of the miner
+		if err := ioutil.WriteFile(filepath.Join(outDir, fmt.Sprintf("miner_%d", i)), []byte(minerLog), os.ModePerm); err != nil {
+			return err
+		}
+		// Log the block tree belonging to this miner
+		if err := ioutil.WriteFile(filepath.Join(outDir, fmt.Sprintf("miner_%d_bt", i)), []byte(m.Blocks.format(m.Chain)), os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range miners {
+		if m.Attacker {
+			r := s.summary()
+			logf("ATTACK attacker_hr_share=%0.3f attacker_share=%0.3f attacker_reorgs=%0.2f reorgs.depth_max=%d", r.AttackerHashrateShare, r.AttackerShare, r.AttackerReorgs, r.ReorgDepthMax)
+			if victim, e := s.eclipse(); victim != nil {
+				logf("ECLIPSE victim=%s occupy=%0.2f filter=%v feed=%v victim_wasted=%0.3f victim_divergence=%d",
+					victim.Address, e.occupy, e.filter, e.feed, r.VictimWasted, r.VictimDivergence)
+			}
+			if ds := s.doubleSpender; ds != nil {
+				logf("DOUBLESPEND tx_block=%d confirmations=%d give_up_behind=%d success=%v seconds=%0.1f nakamoto=%0.4f rosenfeld=%0.4f rosenfeld_nopremine=%0.4f",
+					ds.n, ds.z, ds.giveUp, r.DoubleSpendSuccess == 1, r.DoubleSpendSeconds, r.DoubleSpendNakamoto, r.DoubleSpendRosenfeld, r.DoubleSpendRosenfeldNoPremine)
+				logf("DOUBLESPEND the estimates let the attacker catch up from any depth, at any time; this one gives up %d blocks behind (0 is never) and at the end of the run, so they are not directly comparable", ds.giveUp)
+			}
+			break
+		}
+	}
+
+	if !opts.skipPlots {
+		logf("Making plots...")
+		plotAll(outDir, s, miners)
+	}
+
+	if anim != nil {
+		return anim.finish(logf)
+	}
+	return nil
+}
+
+// resultsLog formats the miner's end-of-run statistics.
+func (m *Miner) resultsLog() string {
+	kMean, _ := stats.Mean(m.Blocks.Ks())
+	kMed, _ := stats.Median(m.Blocks.Ks())
+	kMode, _ := stats.Mode(m.Blocks.Ks())
+
+	intervalsMean, _ := stats.Mean(m.Chain.Intervals())
+	intervalsMean = intervalsMean / float64(m.sim.TicksPerSecond)
+	difficultiesMean, _ := stats.Mean(m.Chain.Difficulties())
+
+	reorgMagsMean := 0.0
+	if mags := m.reorgMagnitudes(); len(mags) > 0 {
+		reorgMagsMean, _ = stats.Mean(mags)
+	}
+
+	wins := m.Chain.Wins(m.Address)
+
+	rewards, uncleRewards := m.Chain.Rewards(m.sim.Params, m.Address)
+	uncleRewardsShare := 0.0
+	if rewards > 0 {
+		uncleRewardsShare = float64(uncleRewards) / float64(rewards)
+	}
+
+	// Miners that never arbitrate, like a selfish attacker on its own chain, made no decisions to count.
+	objectiveDecs := 0.0
+	if m.ConsensusArbitrations > 0 {
+		objectiveDecs = float64(m.ConsensusObjectiveArbitrations) / float64(m.ConsensusArbitrations)
+	}
+
+	orphanWaitMean := 0.0
+	if len(m.orphanWaits) > 0 {
+		orphanWaitMean, _ = stats.Mean(m.orphanWaits)
+	}
+
+	minerLog := fmt.Sprintf(`a=%s c=%s tb=%s hr=%0.2f winr=%0.3f wins=%d head.i=%d head.tabs=%d head.td=%d head.tdtabs=%d k_mean=%0.3f k_med=%0.3f k_mode=%v intervals_mean=%0.3fs d_mean.rel=%0.3f balance=%d objective_decs=%0.3f arbs=%d reorgs.mag_mean=%0.3f reorgs.depth_max=%d orphans=%d fetches=%d orphan_wait_mean=%0.3fs uncle_rate=%0.3f uncle_rewards.share=%0.3f
+`,
+		m.Address, m.ConsensusAlgorithm, m.TieBreaker, m.Hashrate, float64(wins)/float64(m.head.i), wins, /* m.HashesPerTick, */
+		m.head.i, m.head.tabs, m.head.td, m.head.ttdtabs,
+		kMean, kMed, kMode,
+		intervalsMean, difficultiesMean/bigFloat(m.sim.genesis.d),
+		m.Balance,
+		objectiveDecs,
+		m.ConsensusArbitrations,
+		reorgMagsMean, m.reorgDepthMax(),
+		m.Orphans, m.ParentFetches, orphanWaitMean,
+		m.Chain.UncleRate(), uncleRewardsShare)
+
+	// m.ConsensusArbitrations/m.head.i should be the kMean
+	// This is: how many block decisions were arbitrated (ie how many total blocks were seen)
+	// versus   how many blocks were canonical (how high the tree was).
+
+	arbitrationConditionTallyLine := ""
+	// I iterate these copypasta strings because I want order.
+	// Reasons particular to a fork choice rule follow, in name order.
+	names := []string{"consensus_score_high", "height_low", "miner_selfish", "random"}
+	var others []string
+	for name := range m.decisionConditionTallies {
+		known := false
+		for _, n := range names {
+			known = known || n == name
+		}
+		if !known {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	for _, name := range append(names, others...) {
+		v, ok := m.decisionConditionTallies[name]
+		if !ok {
+			continue
+		}
+		fv := float64(v) / float64(m.ConsensusArbitrations)
+		arbitrationConditionTallyLine += fmt.Sprintf(`%s=%0.2f `, name, fv)
+	}
+
+	minerLog += arbitrationConditionTallyLine + "\n"
+	return minerLog
+}
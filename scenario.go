@@ -0,0 +1,605 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mazznoer/colorgrad"
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario declares a complete experiment: its duration, network and TABS parameters,
+// and the miners taking part.
+// Scenarios are loaded from JSON or YAML files; both use the same (json-tagged) field names.
+// Zero values take the simulator defaults.
+type Scenario struct {
+	Name           string         `json:"name"`
+	Seed           int64          `json:"seed"` // zero picks a seed from the clock
+	Duration       Duration       `json:"duration"`
+	TicksPerSecond int64          `json:"ticksPerSecond"`
+	Network        NetworkSpec    `json:"network"`
+	TABS           TABSSpec       `json:"tabs"`
+	Difficulty     DifficultySpec `json:"difficulty"`
+	Freshness      FreshnessSpec  `json:"freshness"` // for miners using the TimeDesc consensus algorithm
+	Miners         []MinerSpec    `json:"miners"`
+}
+
+type NetworkSpec struct {
+	// MinerNeighborRate is the probability that any (directed) pair of miners are neighbors.
+	MinerNeighborRate *float64 `json:"minerNeighborRate"`
+
+	// LatencySeconds is the default block propagation latency for miners that do not set their own.
+	// It is the median of lognormal latencies.
+	LatencySeconds *float64 `json:"latencySeconds"`
+
+	// Latency is the distribution of link latencies (default constant).
+	Latency *LatencySpec `json:"latency"`
+
+	// BandwidthMbps is the bandwidth of every link, in megabits per second.
+	// A block takes blockSizeBytes over the bandwidth to send, on top of its link's latency.
+	// Zero is unlimited.
+	BandwidthMbps  float64 `json:"bandwidthMbps"`
+	BlockSizeBytes int64   `json:"blockSizeBytes"`
+
+	// Topology is the graph of neighbors; the default links miners at minerNeighborRate.
+	Topology *TopologySpec `json:"topology"`
+}
+
+type TABSSpec struct {
+	AdjustmentDenominator int64 `json:"adjustmentDenominator"`
+	Genesis               int64 `json:"genesis"`
+}
+
+// MinerSpec declares a single miner, or, when Count > 1, a group of miners
+// whose hashrates are drawn from HashrateDistribution.
+type MinerSpec struct {
+	// Name is the miner's address, which is also used as its plot color,
+	// so it must be 6 hex digits. Groups are named automatically.
+	Name string `json:"name"`
+
+	Count                int    `json:"count"`
+	HashrateDistribution string `json:"hashrateDistribution"` // equal, longtail
+	BalanceDistribution  string `json:"balanceDistribution"`  // inverse (default), proportional
+
+	// Hashrate is relative to the genesis difficulty; 1 mines blocks at the target rate alone.
+	// For a group it is the share of the group as a whole (default 1).
+	Hashrate   float64 `json:"hashrate"`
+	Balance    *int64  `json:"balance"`
+	BalanceCap int64   `json:"balanceCap"`
+
+	ConsensusAlgorithm string `json:"consensusAlgorithm"`
+	TieBreaker         string `json:"tieBreaker"` // default selfFirst+random
+
+	// StrategySkipRandom is shorthand for the selfFirst+firstSeen tie breaker.
+	StrategySkipRandom bool `json:"strategySkipRandom"`
+
+	// Attacker marks the adversary, whose success the attack metrics measure.
+	Attacker bool `json:"attacker"`
+
+	// Strategy, if set, is the miner's strategy (see StrategySpec). Selfish, private, doubleSpend and eclipse miners are attackers.
+	Strategy *StrategySpec `json:"strategy"`
+
+	// Selfish is shorthand for the selfish strategy.
+	Selfish *SelfishSpec `json:"selfish"`
+
+	// Difficulty, if set, is the difficulty adjustment algorithm of the miner's blocks, in place of the scenario's.
+	Difficulty *DifficultySpec `json:"difficulty"`
+
+	// ActiveFrom and ActiveUntil bound the time the miner hashes, eg. to join or leave the network
+	// part way through a run. Zero ActiveUntil is the end of the run.
+	ActiveFrom  Duration `json:"activeFrom"`
+	ActiveUntil Duration `json:"activeUntil"`
+
+	// LatencySeconds, if set, is the constant latency of the links the miner sends blocks over,
+	// in place of the network's latency distribution.
+	LatencySeconds *float64 `json:"latencySeconds"`
+
+	// SendDelay and ReceiveDelay are shorthand for the delay strategy.
+	SendDelay    *DelayPolicy `json:"sendDelay"`
+	ReceiveDelay *DelayPolicy `json:"receiveDelay"`
+}
+
+const (
+	delayPolicyConstant     = "constant"
+	delayPolicyTABSPostpone = "tabsPostpone"
+)
+
+// DelayPolicy describes a delay miner's send or receive delay.
+//
+//	constant:     always delay Seconds.
+//	tabsPostpone: delay Seconds, plus ExtraSeconds when a TDTABS miner receives a block whose TABS
+//	              did not rise and knows it could produce a block with a better TABS.
+type DelayPolicy struct {
+	Type         string  `json:"type"`
+	Seconds      float64 `json:"seconds"`
+	ExtraSeconds float64 `json:"extraSeconds"`
+}
+
+// Duration is a time.Duration which (un)marshals as a string, eg. "6h".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"6h\": %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadScenario reads, decodes and validates a scenario file.
+// Files ending in .yaml or .yml are read as YAML, everything else as JSON.
+// Unknown fields are errors.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := decodeScenario(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("scenario %s: %w", path, err)
+	}
+	if sc.Name == "" {
+		sc.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if t := sc.Network.Topology; t != nil && t.File != "" && !filepath.IsAbs(t.File) {
+		t.File = filepath.Join(filepath.Dir(path), t.File)
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, fmt.Errorf("scenario %s: %w", path, err)
+	}
+	return sc, nil
+}
+
+func decodeScenario(data []byte, ext string) (*Scenario, error) {
+	data, err := normalizeYAML(data, ext)
+	if err != nil {
+		return nil, err
+	}
+	sc := &Scenario{}
+	if err := decodeStrict(data, sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// normalizeYAML converts YAML (by file extension) to JSON, so that both formats
+// share one set of field names and strictness. Other data is returned as is.
+func normalizeYAML(data []byte, ext string) ([]byte, error) {
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		return json.Marshal(v)
+	}
+	return data, nil
+}
+
+// decodeStrict decodes JSON into v, rejecting unknown fields.
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// clone returns a copy of the scenario whose miners can be changed independently.
+func (sc Scenario) clone() Scenario {
+	sc.Miners = append([]MinerSpec(nil), sc.Miners...)
+	return sc
+}
+
+// attacker tells whether the miner is an adversary: marked so, or with an attacking strategy.
+func (ms MinerSpec) attacker() bool {
+	st := ms.strategy()
+	if st == nil {
+		return ms.Attacker
+	}
+	switch st.Type {
+	case strategySelfish, strategyPrivate, strategyDoubleSpend, strategyEclipse:
+		return true
+	}
+	return ms.Attacker
+}
+
+// doubleSpends tells whether one of the scenario's miners is a double spender.
+func (sc *Scenario) doubleSpends() bool {
+	for _, ms := range sc.Miners {
+		if st := ms.strategy(); st != nil && st.Type == strategyDoubleSpend {
+			return true
+		}
+	}
+	return false
+}
+
+// strategy is the miner's strategy spec, its shorthands spelled out, or nil if it has none.
+func (ms MinerSpec) strategy() *StrategySpec {
+	switch {
+	case ms.Strategy != nil:
+		return ms.Strategy
+	case ms.Selfish != nil:
+		return &StrategySpec{Type: strategySelfish, SelfishSpec: *ms.Selfish}
+	case ms.SendDelay != nil || ms.ReceiveDelay != nil:
+		return &StrategySpec{Type: strategyDelay, SendDelay: ms.SendDelay, ReceiveDelay: ms.ReceiveDelay}
+	}
+	return nil
+}
+
+// Validate checks the scenario for values the simulator cannot run with.
+func (sc *Scenario) Validate() error {
+	if sc.Duration < 0 {
+		return errors.New("duration must not be negative")
+	}
+	if sc.Duration != 0 && time.Duration(sc.Duration) < time.Second {
+		return errors.New("duration must be at least 1s")
+	}
+	if sc.TicksPerSecond < 0 {
+		return errors.New("ticksPerSecond must not be negative")
+	}
+	if r := sc.Network.MinerNeighborRate; r != nil && (*r < 0 || *r > 1) {
+		return fmt.Errorf("network.minerNeighborRate must be within [0,1], got %v", *r)
+	}
+	if l := sc.Network.LatencySeconds; l != nil && *l < 0 {
+		return fmt.Errorf("network.latencySeconds must not be negative, got %v", *l)
+	}
+	if l := sc.Network.Latency; l != nil {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("network.latency: %w", err)
+		}
+	}
+	if sc.Network.BandwidthMbps < 0 {
+		return fmt.Errorf("network.bandwidthMbps must not be negative, got %v", sc.Network.BandwidthMbps)
+	}
+	if sc.Network.BlockSizeBytes < 0 {
+		return fmt.Errorf("network.blockSizeBytes must not be negative, got %d", sc.Network.BlockSizeBytes)
+	}
+	if t := sc.Network.Topology; t != nil {
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("network.topology: %w", err)
+		}
+	}
+	if d := sc.TABS.AdjustmentDenominator; d != 0 && d < 2 {
+		return fmt.Errorf("tabs.adjustmentDenominator must be at least 2, got %d", d)
+	}
+	if sc.TABS.Genesis < 0 {
+		return fmt.Errorf("tabs.genesis must not be negative, got %d", sc.TABS.Genesis)
+	}
+	if err := sc.Difficulty.validate(); err != nil {
+		return fmt.Errorf("difficulty: %w", err)
+	}
+	if err := sc.Freshness.validate(); err != nil {
+		return fmt.Errorf("freshness: %w", err)
+	}
+	if len(sc.Miners) == 0 {
+		return errors.New("no miners")
+	}
+	for i, ms := range sc.Miners {
+		if err := ms.validate(); err != nil {
+			return fmt.Errorf("miners[%d]: %w", i, err)
+		}
+	}
+	seen := map[string]bool{}
+	doubleSpenders := 0
+	var eclipser *MinerSpec
+	for _, ms := range sc.expandMiners() {
+		ms := ms
+		if st := ms.strategy(); st != nil && st.Type == strategyDoubleSpend {
+			doubleSpenders++
+		}
+		if doubleSpenders > 1 {
+			return errors.New("only one miner can double spend")
+		}
+		if st := ms.strategy(); st != nil && st.Type == strategyEclipse {
+			if eclipser != nil {
+				return errors.New("only one miner can eclipse")
+			}
+			eclipser = &ms
+		}
+		if seen[ms.Name] {
+			return fmt.Errorf("miner name %s is used more than once", ms.Name)
+		}
+		seen[ms.Name] = true
+	}
+	if eclipser != nil {
+		victim := eclipser.strategy().Victim
+		if victim == eclipser.Name || !seen[victim] {
+			return fmt.Errorf("eclipse victim %s must name another miner", victim)
+		}
+	}
+	return nil
+}
+
+func (ms MinerSpec) validate() error {
+	if ms.Count < 0 {
+		return fmt.Errorf("count must not be negative, got %d", ms.Count)
+	}
+	if ms.Count > 1 {
+		if ms.Name != "" {
+			return errors.New("name cannot be set for a group (count > 1)")
+		}
+		switch ms.HashrateDistribution {
+		case HashrateDistEqual.String(), HashrateDistLongtail.String():
+		default:
+			return fmt.Errorf("hashrateDistribution must be %q or %q, got %q", HashrateDistEqual, HashrateDistLongtail, ms.HashrateDistribution)
+		}
+		switch ms.BalanceDistribution {
+		case "", "inverse", "proportional":
+		default:
+			return fmt.Errorf("balanceDistribution must be \"inverse\" or \"proportional\", got %q", ms.BalanceDistribution)
+		}
+		if ms.Balance != nil {
+			return errors.New("balance cannot be set for a group (count > 1); use balanceDistribution")
+		}
+	} else {
+		if _, err := ParseHexColor("#" + ms.Name); err != nil || len(ms.Name) != 6 {
+			return fmt.Errorf("name must be 6 hex digits (it is used as the plot color), got %q", ms.Name)
+		}
+		if ms.HashrateDistribution != "" || ms.BalanceDistribution != "" {
+			return errors.New("hashrateDistribution and balanceDistribution only apply to groups (count > 1)")
+		}
+		if ms.Hashrate <= 0 {
+			return fmt.Errorf("hashrate must be positive, got %v", ms.Hashrate)
+		}
+	}
+	if ms.Hashrate < 0 {
+		return fmt.Errorf("hashrate must not be negative, got %v", ms.Hashrate)
+	}
+	if ms.Balance != nil && *ms.Balance < 0 {
+		return fmt.Errorf("balance must not be negative, got %d", *ms.Balance)
+	}
+	if ms.BalanceCap < 0 {
+		return fmt.Errorf("balanceCap must not be negative, got %d", ms.BalanceCap)
+	}
+	if _, err := parseConsensusAlgorithm(ms.ConsensusAlgorithm); err != nil {
+		return fmt.Errorf("consensusAlgorithm: %w", err)
+	}
+	if _, err := parseTieBreaker(ms.TieBreaker); err != nil {
+		return fmt.Errorf("tieBreaker: %w", err)
+	}
+	if ms.Difficulty != nil {
+		if err := ms.Difficulty.validate(); err != nil {
+			return fmt.Errorf("difficulty: %w", err)
+		}
+	}
+	if ms.ActiveFrom < 0 || ms.ActiveUntil < 0 {
+		return errors.New("activeFrom and activeUntil must not be negative")
+	}
+	if ms.ActiveUntil != 0 && ms.ActiveUntil <= ms.ActiveFrom {
+		return errors.New("activeUntil must be after activeFrom")
+	}
+	if ms.Strategy != nil {
+		if ms.Selfish != nil || ms.SendDelay != nil || ms.ReceiveDelay != nil {
+			return errors.New("strategy cannot be combined with selfish, sendDelay or receiveDelay")
+		}
+		if err := ms.Strategy.validate(); err != nil {
+			return fmt.Errorf("strategy: %w", err)
+		}
+	}
+	if err := ms.Selfish.validate(); err != nil {
+		return fmt.Errorf("selfish: %w", err)
+	}
+	if ms.Selfish != nil && (ms.SendDelay != nil || ms.ReceiveDelay != nil) {
+		return errors.New("selfish cannot be combined with sendDelay or receiveDelay")
+	}
+	if ms.StrategySkipRandom && ms.TieBreaker != "" {
+		return errors.New("strategySkipRandom cannot be combined with tieBreaker")
+	}
+	if ms.LatencySeconds != nil && *ms.LatencySeconds < 0 {
+		return fmt.Errorf("latencySeconds must not be negative, got %v", *ms.LatencySeconds)
+	}
+	if err := ms.SendDelay.validate(); err != nil {
+		return fmt.Errorf("sendDelay: %w", err)
+	}
+	if err := ms.ReceiveDelay.validate(); err != nil {
+		return fmt.Errorf("receiveDelay: %w", err)
+	}
+	return nil
+}
+
+func (p *DelayPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Type {
+	case delayPolicyConstant:
+		if p.ExtraSeconds != 0 {
+			return errors.New("extraSeconds only applies to type tabsPostpone")
+		}
+	case delayPolicyTABSPostpone:
+	default:
+		return fmt.Errorf("type must be %q or %q, got %q", delayPolicyConstant, delayPolicyTABSPostpone, p.Type)
+	}
+	if p.Seconds < 0 || p.ExtraSeconds < 0 {
+		return errors.New("seconds must not be negative")
+	}
+	return nil
+}
+
+// expandMiners returns one spec per miner, with groups expanded
+// into named miners with their own hashrates and balances.
+func (sc *Scenario) expandMiners() (out []MinerSpec) {
+	genesisTABS := sc.TABS.Genesis
+	if genesisTABS == 0 {
+		genesisTABS = DefaultParams().GenesisBlockTABS
+	}
+	// Group miners are named by color; avoid the colors of individually named miners.
+	taken := map[color.RGBA]bool{}
+	for _, ms := range sc.Miners {
+		if ms.Count <= 1 {
+			if clr, err := ParseHexColor("#" + ms.Name); err == nil {
+				taken[clr] = true
+			}
+		}
+	}
+
+	for _, ms := range sc.Miners {
+		if ms.Count <= 1 {
+			out = append(out, ms)
+			continue
+		}
+
+		share := ms.Hashrate
+		if share == 0 {
+			share = 1
+		}
+		var dist HashrateDistType
+		if ms.HashrateDistribution == HashrateDistLongtail.String() {
+			dist = HashrateDistLongtail
+		}
+		hashrates := generateMinerHashrates(dist, ms.Count)
+
+		// We use relative hashrate as a proxy for balance;
+		// more mining capital :: more currency capital.
+		supply := genesisTABS / presumeMinerShareBalancePerBlockDenominator * int64(ms.Count)
+
+		grad := colorgrad.Viridis()
+
+		for i := 0; i < ms.Count; i++ {
+			clr, _ := ParseHexColor(grad.At(1 - (hashrates[i] * (1 / hashrates[0]))).Hex())
+			for taken[clr] {
+				// Make sure colors (names) are unique.
+				clr.R++
+			}
+			taken[clr] = true
+
+			balanceShare := hashrates[ms.Count-1-i] // backwards
+			if ms.BalanceDistribution == "proportional" {
+				balanceShare = hashrates[i]
+			}
+			balance := int64(float64(supply) * balanceShare)
+
+			m := ms
+			m.Name = fmt.Sprintf("%02x%02x%02x", clr.R, clr.G, clr.B)
+			m.Count = 1
+			m.HashrateDistribution = ""
+			m.BalanceDistribution = ""
+			m.Hashrate = share * hashrates[i]
+			m.Balance = &balance
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// params returns the simulation parameters declared by the scenario.
+func (sc *Scenario) params() Params {
+	p := DefaultParams()
+	p.Seed = sc.Seed
+	if sc.TicksPerSecond != 0 {
+		p.TicksPerSecond = sc.TicksPerSecond
+	}
+	duration := time.Duration(sc.Duration)
+	if duration == 0 {
+		duration = 6 * time.Hour
+	}
+	p.SetDuration(duration)
+	if sc.Network.MinerNeighborRate != nil {
+		p.MinerNeighborRate = *sc.Network.MinerNeighborRate
+	}
+	if sc.Network.LatencySeconds != nil {
+		p.LatencySeconds = *sc.Network.LatencySeconds
+	}
+	if sc.Network.Latency != nil {
+		p.Latency = *sc.Network.Latency
+	}
+	p.BandwidthMbps = sc.Network.BandwidthMbps
+	p.BlockSizeBytes = sc.Network.BlockSizeBytes
+	if sc.Network.Topology != nil {
+		p.Topology = *sc.Network.Topology
+	}
+	if sc.TABS.AdjustmentDenominator != 0 {
+		p.TabsAdjustmentDenominator = sc.TABS.AdjustmentDenominator
+	}
+	if sc.TABS.Genesis != 0 {
+		p.GenesisBlockTABS = sc.TABS.Genesis
+	}
+	p.Difficulty = sc.Difficulty
+	p.Freshness = sc.Freshness
+	p.CountMiners = int64(len(sc.expandMiners()))
+	return p
+}
+
+// newMiners builds the scenario's miners, each with the genesis block as head.
+func (sc *Scenario) newMiners(s *Simulation, minerEvents chan minerEvent) (miners []*Miner) {
+	for i, ms := range sc.expandMiners() {
+		algo, _ := parseConsensusAlgorithm(ms.ConsensusAlgorithm)
+
+		bt := NewBlockTree()
+		bt.AppendBlockByNumber(s.genesis)
+
+		m := &Miner{
+			Index:                    int64(i),
+			Address:                  ms.Name,
+			Blocks:                   bt,
+			Hashrate:                 ms.Hashrate,
+			HashesPerTick:            int64(bigFloat(s.genesis.d) * ms.Hashrate),
+			BalanceCap:               ms.BalanceCap,
+			ConsensusAlgorithm:       algo,
+			TieBreaker:               TieBreaker(ms.TieBreaker),
+			Difficulty:               ms.Difficulty,
+			ActiveFrom:               time.Duration(ms.ActiveFrom).Seconds(),
+			ActiveUntil:              time.Duration(ms.ActiveUntil).Seconds(),
+			Attacker:                 ms.attacker(),
+			Strategy:                 s.defaultStrategy(),
+			neighbors:                []*Miner{},
+			reorgs:                   make(map[int64]reorg),
+			decisionConditionTallies: make(map[string]int),
+			cord:                     minerEvents,
+			sim:                      s,
+		}
+		if ms.Balance != nil {
+			m.Balance = *ms.Balance
+		}
+		if ms.StrategySkipRandom {
+			m.TieBreaker = tieSelfFirst + TieFirstSeen
+		}
+
+		if ms.LatencySeconds != nil {
+			latency := *ms.LatencySeconds
+			m.Latency = func(to *Miner, b *Block) float64 {
+				return latency + s.transferSeconds(b)
+			}
+		}
+
+		if st := ms.strategy(); st != nil {
+			m.Strategy = st.strategy(s)
+		}
+
+		m.processBlock(s.genesis) // sets head to genesis
+		miners = append(miners, m)
+	}
+	return miners
+}
+
+// seconds is the delay of b for the miner in v; none if p is nil.
+func (p *DelayPolicy) seconds(v MinerView, b *Block) float64 {
+	if p == nil {
+		return 0
+	}
+	delay := p.Seconds
+	if p.Type == delayPolicyTABSPostpone && v.ConsensusAlgorithm() == TDTABS && v.Address() != b.miner {
+		localTabs := v.Balance() + v.TxPoolTABs(b.i)
+		if b.tabsCmp <= 0 && localTabs > b.tabs {
+			// The miner knows they have a better TABS than the received block.
+			// This gives them an edge in potential consensus points.
+			delay += p.ExtraSeconds
+		}
+	}
+	return delay
+}
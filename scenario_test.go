@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadScenario_Files(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("scenarios", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no scenario files")
+	}
+	for _, f := range files {
+		sc, err := LoadScenario(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.TrimSuffix(filepath.Base(f), ".yaml"); sc.Name != want {
+			t.Errorf("%s: name=%s want=%s", f, sc.Name, want)
+		}
+		if n := len(sc.expandMiners()); n != 13 {
+			t.Errorf("%s: miners=%d want=13", f, n)
+		}
+	}
+}
+
+func TestLoadScenario_JSON(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "two.json")
+	err := ioutil.WriteFile(f, []byte(`{
+		"duration": "1h",
+		"tabs": {"adjustmentDenominator": 64},
+		"miners": [
+			{"count": 3, "hashrateDistribution": "equal", "hashrate": 0.6, "consensusAlgorithm": "TDTABS"},
+			{"name": "ff0000", "hashrate": 0.4, "balance": 500, "consensusAlgorithm": "TD"}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := LoadScenario(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Name != "two" {
+		t.Errorf("name=%s", sc.Name)
+	}
+	ms := sc.expandMiners()
+	if len(ms) != 4 {
+		t.Fatalf("miners=%d", len(ms))
+	}
+	for _, m := range ms[:3] {
+		if m.Hashrate < 0.1999 || m.Hashrate > 0.2001 {
+			t.Errorf("group hashrate=%v want=0.2", m.Hashrate)
+		}
+	}
+	if ms[3].Name != "ff0000" || *ms[3].Balance != 500 {
+		t.Errorf("miner=%+v", ms[3])
+	}
+}
+
+func TestScenarioValidate(t *testing.T) {
+	cases := []struct {
+		doc     string
+		wantErr string
+	}{
+		{`miners: []`, "no miners"},
+		{`duration: 6`, "duration must be a string"},
+		{`bogus: 1`, `unknown field "bogus"`},
+		{`{network: {minerNeighborRate: 1.5}, miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD}]}`, "minerNeighborRate"},
+		{`{network: {latency: {type: empirical}}, miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD}]}`, "network.latency: empirical latency needs samples"},
+		{`{network: {latency: {type: pareto}}, miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD}]}`, "network.latency: type must be"},
+		{`{network: {topology: {type: ring}}, miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD}]}`, `network.topology: unknown type "ring"`},
+		{`{network: {topology: {type: edgeList}}, miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD}]}`, "network.topology: file is required"},
+		{`miners: [{name: red, hashrate: 1, consensusAlgorithm: TD}]`, "miners[0]: name must be 6 hex digits"},
+		{`miners: [{name: ff0000, hashrate: 0, consensusAlgorithm: TD}]`, "miners[0]: hashrate must be positive"},
+		{`{freshness: {by: mined}, miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TimeDesc}]}`, "freshness: by must be"},
+		{`{difficulty: {type: bitcoin}, miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD}]}`, `difficulty: unknown type "bitcoin"`},
+		{`{difficulty: {halfLifeSeconds: 3600}, miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD}]}`, "halfLifeSeconds only applies to asert"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, activeFrom: 2h, activeUntil: 1h}]`, "miners[0]: activeUntil"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: Casper}]`, `miners[0]: consensusAlgorithm: unknown consensus algorithm: "Casper"`},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, tieBreaker: coin}]`, `miners[0]: tieBreaker: unknown tie breaker: "coin"`},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, tieBreaker: firstSeen, strategySkipRandom: true}]`, "cannot be combined"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, selfish: {gamma: 1.5}}]`, "miners[0]: selfish: gamma must be between 0 and 1"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, selfish: {}, sendDelay: {type: constant, seconds: 60}}]`, "selfish cannot be combined with sendDelay"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: greedy}}]`, `miners[0]: strategy: unknown type "greedy"`},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: delay, releaseAfter: 1h}}]`, "miners[0]: strategy: releaseAfter only applies to private"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: private, gamma: 0.5}}]`, "only apply to selfish"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: selfish}, selfish: {}}]`, "strategy cannot be combined"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: doubleSpend, txBlock: 10}}]`, "miners[0]: strategy: confirmations must be positive"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: private, confirmations: 2}}]`, "only apply to doubleSpend"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: doubleSpend, txBlock: 10, confirmations: 2}}, {name: ff0001, hashrate: 1, consensusAlgorithm: TD, strategy: {type: doubleSpend, txBlock: 10, confirmations: 2}}]`, "only one miner can double spend"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: eclipse}}]`, "miners[0]: strategy: victim is required"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: eclipse, victim: 00ff00, occupy: 2}}]`, "occupy must be between 0 and 1"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: private, feed: true}}]`, "only apply to eclipse"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: eclipse, victim: 00ff00}}]`, "eclipse victim 00ff00 must name another miner"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, strategy: {type: eclipse, victim: ff0000}}]`, "eclipse victim ff0000 must name another miner"},
+		{`miners: [{count: 3, hashrateDistribution: pareto, consensusAlgorithm: TD}]`, "miners[0]: hashrateDistribution"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD, sendDelay: {type: sometimes}}]`, "miners[0]: sendDelay: type must be"},
+		{`miners: [{name: ff0000, hashrate: 1, consensusAlgorithm: TD}, {name: ff0000, hashrate: 1, consensusAlgorithm: TD}]`, "used more than once"},
+	}
+	for _, c := range cases {
+		f := filepath.Join(t.TempDir(), "bad.yaml")
+		if err := ioutil.WriteFile(f, []byte(c.doc), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadScenario(f)
+		if err == nil {
+			t.Errorf("%s: want error containing %q", c.doc, c.wantErr)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("%s: error=%q want containing %q", c.doc, err, c.wantErr)
+		}
+	}
+}
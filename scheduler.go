@@ -0,0 +1,99 @@
+package main
+
+import "container/heap"
+
+type eventKind int
+
+const (
+	// eventDiscovery is a miner solving the puzzle for a block on its head.
+	eventDiscovery eventKind = iota
+	// eventDelivery is a block arriving at a miner.
+	eventDelivery
+)
+
+// event is something that happens to a miner at a point in simulated time.
+type event struct {
+	at    float64 // seconds since genesis
+	seq   uint64  // scheduling order, which breaks ties so that runs are reproducible
+	kind  eventKind
+	miner *Miner
+	msg   message // the delivery
+
+	index int // position in the queue, or -1 once removed
+}
+
+// eventQueue is a min-heap of events by time, then scheduling order.
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *eventQueue) Push(x interface{}) {
+	e := x.(*event)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*q = old[:len(old)-1]
+	return e
+}
+
+// scheduler is a discrete-event clock: simulated time jumps straight
+// from one event to the next instead of advancing in fixed ticks.
+type scheduler struct {
+	now    float64 // seconds since genesis
+	seq    uint64
+	events eventQueue
+}
+
+// schedule queues e. Events cannot happen in the past; those that would are due now.
+func (sc *scheduler) schedule(e *event) {
+	if e.at < sc.now {
+		e.at = sc.now
+	}
+	e.seq = sc.seq
+	sc.seq++
+	heap.Push(&sc.events, e)
+}
+
+// reschedule moves e to a new time, queueing it again if it has already happened.
+func (sc *scheduler) reschedule(e *event, at float64) {
+	if e.index < 0 {
+		e.at = at
+		sc.schedule(e)
+		return
+	}
+	if at < sc.now {
+		at = sc.now
+	}
+	e.at = at
+	e.seq = sc.seq
+	sc.seq++
+	heap.Fix(&sc.events, e.index)
+}
+
+// next removes the earliest event and advances the clock to it.
+// It returns nil once no events remain at or before end.
+func (sc *scheduler) next(end float64) *event {
+	if len(sc.events) == 0 || sc.events[0].at > end {
+		return nil
+	}
+	e := heap.Pop(&sc.events).(*event)
+	sc.now = e.at
+	return e
+}
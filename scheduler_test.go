@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestScheduler_Order(t *testing.T) {
+	var sc scheduler
+	a := &event{at: 2}
+	b := &event{at: 1}
+	c := &event{at: 2}
+	d := &event{at: 5}
+	for _, e := range []*event{a, b, c, d} {
+		sc.schedule(e)
+	}
+
+	// Move d ahead of everything but b; a and c keep their scheduling order.
+	sc.reschedule(d, 1.5)
+
+	want := []*event{b, d, a, c}
+	for i, w := range want {
+		e := sc.next(10)
+		if e != w {
+			t.Fatalf("event %d: got at=%v seq=%d, want at=%v seq=%d", i, e.at, e.seq, w.at, w.seq)
+		}
+		if sc.now != w.at {
+			t.Fatalf("event %d: now=%v want=%v", i, sc.now, w.at)
+		}
+	}
+	if e := sc.next(10); e != nil {
+		t.Fatalf("unexpected event at=%v", e.at)
+	}
+
+	// Events can't be scheduled in the past, and a popped event can be queued again.
+	sc.reschedule(a, 0)
+	if a.at != sc.now {
+		t.Fatalf("at=%v want=%v", a.at, sc.now)
+	}
+	sc.schedule(&event{at: 11})
+	if e := sc.next(10); e != a {
+		t.Fatal("rescheduled event not returned")
+	}
+	if e := sc.next(10); e != nil {
+		t.Fatalf("event after end returned: at=%v", e.at)
+	}
+}
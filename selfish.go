@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Selfish mining (Eyal and Sirer, "Majority is not Enough", 2014) and its stubborn variants
+// (Nayak et al., "Stubborn Mining", 2016).
+//
+// A selfish miner mines on a private branch, withholding its blocks, and publishes them
+// in reaction to the public chain so as to waste the honest miners' work:
+//
+//   - ahead by one when an honest block arrives, it publishes its branch to race the honest block;
+//   - ahead by two, it publishes the whole branch, which overrides the honest block;
+//   - further ahead, it publishes blocks only to keep level with the public chain;
+//   - behind, it abandons its branch and adopts the public chain;
+//   - racing with a published branch, it publishes the next block it finds, winning the race.
+//
+// The stubborn variants trade safety for more waste: lead-stubborn only ever matches the public chain,
+// never overriding it; equal-fork-stubborn keeps the block that would win a race private;
+// and trail-stubborn keeps mining on its branch until it falls more than TrailStubborn blocks behind.
+//
+// Lengths, not the fork choice, drive the strategy, as in the literature; how well it does against
+// a fork choice that is not the longest chain's is one of the things to measure.
+
+// SelfishSpec configures a selfish miner. The zero value is Eyal and Sirer's SM1.
+type SelfishSpec struct {
+	LeadStubborn      bool `json:"leadStubborn"`
+	EqualForkStubborn bool `json:"equalForkStubborn"`
+	TrailStubborn     int  `json:"trailStubborn"` // how many blocks behind the miner keeps its branch
+
+	// Gamma, if set, is the share of the honest miners that mine on the selfish miner's block
+	// when it ties with another: each honest miner prefers it with probability Gamma.
+	// Unset, the honest miners' tie breakers and the network decide.
+	Gamma *float64 `json:"gamma"`
+}
+
+func (s *SelfishSpec) validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.TrailStubborn < 0 {
+		return fmt.Errorf("trailStubborn must not be negative, got %d", s.TrailStubborn)
+	}
+	if s.Gamma != nil && (*s.Gamma < 0 || *s.Gamma > 1) {
+		return fmt.Errorf("gamma must be between 0 and 1, got %v", *s.Gamma)
+	}
+	return nil
+}
+
+func (s *SelfishSpec) String() string {
+	if s == nil {
+		return "honest"
+	}
+	name := ""
+	if s.LeadStubborn {
+		name += "L"
+	}
+	if s.EqualForkStubborn {
+		name += "F"
+	}
+	if s.TrailStubborn > 0 {
+		name += fmt.Sprintf("T%d", s.TrailStubborn)
+	}
+	if name == "" {
+		return "SM1"
+	}
+	return name
+}
+
+// parseStrategy sets s's variant from its name, as String writes it:
+// SM1, or any of L, F and Tj (eg. T2), in that order (Nayak et al.'s notation, eg. LFT1).
+func (s *SelfishSpec) parseStrategy(name string) error {
+	s.LeadStubborn, s.EqualForkStubborn, s.TrailStubborn = false, false, 0
+	if name == "SM1" {
+		return nil
+	}
+	rest := name
+	if strings.HasPrefix(rest, "L") {
+		s.LeadStubborn, rest = true, rest[1:]
+	}
+	if strings.HasPrefix(rest, "F") {
+		s.EqualForkStubborn, rest = true, rest[1:]
+	}
+	if strings.HasPrefix(rest, "T") {
+		j, err := strconv.Atoi(rest[1:])
+		if err != nil || j < 1 {
+			return fmt.Errorf("unknown selfish strategy %q: T wants a positive number of blocks", name)
+		}
+		s.TrailStubborn, rest = j, ""
+	}
+	if rest != "" || name == "" {
+		return fmt.Errorf("unknown selfish strategy %q (want SM1, or any of L, F and Tj, in that order)", name)
+	}
+	return nil
+}
+
+// selfishStrategy is a selfish miner's strategy, and its view of the race
+// between its private branch and the public chain.
+type selfishStrategy struct {
+	honestStrategy
+	SelfishSpec
+
+	fork   *Block // the block the private branch grows from: the last the miner adopted or overrode with
+	public int64  // the number of the highest public block, the miner's published ones included
+}
+
+// BlockMined withholds b, the miner's own on its head, unless publishing it wins or joins a race.
+func (s *selfishStrategy) BlockMined(v MinerView, b *Block) []Action {
+	head := v.Head()
+	if s.fork == nil {
+		s.fork = head
+	}
+	race := head.i == s.public && head.i > s.fork.i
+	switch {
+	case b.i == s.public:
+		// Caught up from behind: race the public chain.
+		return []Action{s.release(head), s.publish(b), SwitchParent(b)}
+	case race && !s.EqualForkStubborn:
+		// Ahead of a race: publishing wins it.
+		s.fork = b
+		return []Action{s.release(head), s.publish(b), SwitchParent(b)}
+	}
+	return []Action{WithholdUntil(b, math.Inf(1)), SwitchParent(b)}
+}
+
+// BlockReceived keeps mining on the private branch, and publishes from it, or adopts b, as b lengthens the public chain.
+func (s *selfishStrategy) BlockReceived(v MinerView, b *Block) []Action {
+	head := v.Head()
+	if s.fork == nil {
+		s.fork = head
+	}
+	if v.Has(b) || b.miner == v.Address() || b.i <= s.public {
+		// b doesn't lengthen the public chain.
+		return []Action{SwitchParent(head)}
+	}
+	s.public = b.i
+	lead := head.i - b.i
+	switch {
+	case lead < 0 && (head.i == s.fork.i || -lead > int64(s.TrailStubborn)):
+		// Behind: give up the private branch.
+		s.fork = b
+		return []Action{SwitchParent(b)}
+	case lead < 0:
+		// Trail-stubborn: keep mining on the branch.
+		return []Action{SwitchParent(head)}
+	case lead == 0:
+		return []Action{s.release(head), SwitchParent(head)}
+	case lead == 1 && !s.LeadStubborn:
+		s.fork = head
+		return []Action{s.release(head), SwitchParent(head)}
+	}
+	return []Action{s.release(v.Ancestor(head, b.i)), SwitchParent(head)}
+}
+
+// release releases the private branch up to tip, which becomes public.
+func (s *selfishStrategy) release(tip *Block) Action {
+	if tip.i > s.public {
+		s.public = tip.i
+	}
+	return Release(tip)
+}
+
+// publish publishes b, which the miner has just mined, at once.
+func (s *selfishStrategy) publish(b *Block) Action {
+	if b.i > s.public {
+		s.public = b.i
+	}
+	return Publish(b)
+}
+
+// gammaTie chooses between a and b, which tie, when one is a selfish miner's with a configured gamma,
+// and the other is not. The miner decides once whether it favors a selfish block,
+// so that the block arriving again (relayed by other neighbors) does not toss the coin again.
+func (m *Miner) gammaTie(a, b *Block) (*Block, bool) {
+	for _, c := range [][2]*Block{{a, b}, {b, a}} {
+		x, other := c[0], c[1]
+		s := m.sim.minerByAddress(x.miner)
+		if s == nil || s == m || other.miner == x.miner {
+			continue
+		}
+		selfish, ok := s.Strategy.(*selfishStrategy)
+		if !ok || selfish.Gamma == nil {
+			continue
+		}
+		if m.gammaFavors == nil {
+			m.gammaFavors = make(map[string]bool)
+		}
+		favors, ok := m.gammaFavors[x.h]
+		if !ok {
+			favors = m.sim.rand.Float64() < *selfish.Gamma
+			m.gammaFavors[x.h] = favors
+		}
+		if favors {
+			return x, true
+		}
+		return other, true
+	}
+	return nil, false
+}
+
+// minerByAddress returns the simulation's miner with address, or nil.
+func (s *Simulation) minerByAddress(address string) *Miner {
+	for _, m := range s.miners {
+		if m.Address == address {
+			return m
+		}
+	}
+	return nil
+}
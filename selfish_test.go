@@ -0,0 +1,221 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newTestSelfishMiner returns a selfish miner with an honest neighbor, which receives what it publishes at once.
+func newTestSelfishMiner(t *testing.T, spec SelfishSpec) (sim *Simulation, m, neighbor *Miner) {
+	sim = NewSimulation(DefaultParams())
+	m = newTestMiner(t, sim, "00000a")
+	m.Strategy = StrategySpec{Type: strategySelfish, SelfishSpec: spec}.strategy(sim)
+	m.Latency = func(*Miner, *Block) float64 { return 0 }
+	neighbor = newTestMiner(t, sim, "00000b")
+	m.neighbors = []*Miner{neighbor}
+	sim.miners = Miners{m, neighbor}
+	return sim, m, neighbor
+}
+
+// receive delivers b to m at once, as if from an honest neighbor.
+func receive(m *Miner, b *Block) {
+	m.receiveBlock(message{block: b})
+}
+
+// honestChild returns an honest miner's block on parent, as heavy as its parent.
+func honestChild(sim *Simulation, parent *Block) *Block {
+	return &Block{i: parent.i + 1, s: parent.s + 1, d: parent.d, td: new(big.Int).Add(parent.td, parent.d), ttdtabs: parent.ttdtabs, ph: parent.h, h: sim.newBlockHash(), miner: "00000f"}
+}
+
+func TestSelfish_SM1(t *testing.T) {
+	sim, m, neighbor := newTestSelfishMiner(t, SelfishSpec{})
+	published := func(b *Block) bool {
+		for _, x := range neighbor.Blocks[b.i] {
+			if x == b {
+				return true
+			}
+		}
+		return false
+	}
+	mine := func() *Block {
+		sim.sched.now += 10
+		m.mine()
+		return m.head
+	}
+
+	// Ahead by one, the miner withholds its block, and races an honest block with it.
+	s1 := mine()
+	if published(s1) {
+		t.Fatal("s1 published at once")
+	}
+	receive(m, honestChild(sim, sim.genesis))
+	if !published(s1) || m.head != s1 {
+		t.Fatalf("race: s1 published=%v head=%v", published(s1), m.head)
+	}
+	// Its next block wins the race.
+	s2 := mine()
+	if !published(s2) {
+		t.Fatal("s2 not published to win the race")
+	}
+
+	// Ahead by two, it overrides an honest block.
+	s3, s4 := mine(), mine()
+	if published(s3) || published(s4) {
+		t.Fatal("s3 or s4 published at once")
+	}
+	receive(m, honestChild(sim, s2))
+	if !published(s3) || !published(s4) {
+		t.Fatal("s3 and s4 not published to override")
+	}
+
+	// Further ahead, it only keeps level with the public chain.
+	s5, s6, s7 := mine(), mine(), mine()
+	h5 := honestChild(sim, s4)
+	receive(m, h5)
+	if !published(s5) || published(s6) || published(s7) {
+		t.Fatalf("published s5=%v s6=%v s7=%v want only s5", published(s5), published(s6), published(s7))
+	}
+
+	// Ahead by two again, it overrides.
+	receive(m, honestChild(sim, h5))
+	if !published(s6) || !published(s7) {
+		t.Fatal("s6 and s7 not published to override")
+	}
+
+	// Racing, and behind, it gives up its branch.
+	s8 := mine()
+	h8 := honestChild(sim, s7)
+	receive(m, h8)
+	if !published(s8) {
+		t.Fatal("s8 not published to race")
+	}
+	h9 := honestChild(sim, h8)
+	receive(m, h9)
+	if m.head != h9 {
+		t.Errorf("head %v want %v", m.head, h9)
+	}
+	if s9 := mine(); published(s9) {
+		t.Errorf("s9 published at once")
+	}
+}
+
+func TestSelfish_Stubborn(t *testing.T) {
+	for _, c := range []struct {
+		spec SelfishSpec
+		// The miner mines two blocks, an honest block arrives, and then the miner's or honest blocks,
+		// as the steps say; want is what the miner has published at the end, and whether its head is its own.
+		steps     string
+		published int
+		own       bool
+	}{
+		{SelfishSpec{}, "ssh", 2, true},                        // overrides
+		{SelfishSpec{LeadStubborn: true}, "ssh", 1, true},      // only matches
+		{SelfishSpec{}, "shs", 2, true},                        // wins the race
+		{SelfishSpec{EqualForkStubborn: true}, "shs", 1, true}, // keeps the winning block
+		{SelfishSpec{}, "shh", 1, false},                       // gives up
+		{SelfishSpec{TrailStubborn: 1}, "shh", 1, true},        // keeps mining one behind
+		{SelfishSpec{TrailStubborn: 1}, "shhs", 2, true},       // and races when it catches up
+		{SelfishSpec{TrailStubborn: 1}, "shhh", 1, false},      // but not two behind
+	} {
+		sim, m, neighbor := newTestSelfishMiner(t, c.spec)
+		public := sim.genesis
+		for _, step := range c.steps {
+			if step == 's' {
+				sim.sched.now += 10
+				m.mine()
+				continue
+			}
+			public = honestChild(sim, public)
+			receive(m, public)
+		}
+		published := 0
+		for _, bs := range neighbor.Blocks {
+			for _, b := range bs {
+				if b.miner == m.Address {
+					published++
+				}
+			}
+		}
+		if published != c.published || (m.head.miner == m.Address) != c.own {
+			t.Errorf("%s %s: published %d own head %v want %d %v", c.spec.String(), c.steps, published, m.head.miner == m.Address, c.published, c.own)
+		}
+	}
+}
+
+func TestSelfish_Gamma(t *testing.T) {
+	for _, gamma := range []float64{0, 1} {
+		sim, m, neighbor := newTestSelfishMiner(t, SelfishSpec{Gamma: &gamma})
+		selfish := &Block{i: 1, d: sim.genesis.d, td: new(big.Int).Add(sim.genesis.td, sim.genesis.d), ph: sim.genesis.h, h: "0000000a", miner: m.Address}
+		honest := honestChild(sim, sim.genesis)
+		want := honest
+		if gamma == 1 {
+			want = selfish
+		}
+		// Both orders, and again, as when relays deliver blocks more than once.
+		for _, pair := range [][2]*Block{{honest, selfish}, {selfish, honest}, {honest, selfish}} {
+			if got := neighbor.arbitrateBlocks(pair[0], pair[1]); got != want {
+				t.Errorf("gamma %v: chose %v want %v", gamma, got, want)
+			}
+		}
+		if got := neighbor.decisionConditionTallies["gamma"]; got != 3 {
+			t.Errorf("gamma %v: gamma tally %d want 3", gamma, got)
+		}
+	}
+}
+
+func TestSelfishSpec_Strategy(t *testing.T) {
+	for _, name := range []string{"SM1", "L", "F", "T2", "LF", "LT1", "LFT3"} {
+		var s SelfishSpec
+		if err := s.parseStrategy(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if s.String() != name {
+			t.Errorf("%s: parsed as %s", name, s.String())
+		}
+	}
+	for _, name := range []string{"", "X", "FL", "T0", "T", "LTx"} {
+		var s SelfishSpec
+		if err := s.parseStrategy(name); err == nil {
+			t.Errorf("%q: parsed as %s", name, s.String())
+		}
+	}
+}
+
+// TestSelfish_Revenue checks SM1's relative revenue against Eyal and Sirer's formula,
+// on a network without latency or forks of its own, and with constant difficulty.
+func TestSelfish_Revenue(t *testing.T) {
+	revenue := func(alpha, gamma float64) float64 {
+		return (alpha*(1-alpha)*(1-alpha)*(4*alpha+gamma*(1-2*alpha)) - alpha*alpha*alpha) /
+			(1 - alpha*(1+(2-alpha)*alpha))
+	}
+	rate, latency := 1.0, 0.0
+	for _, gamma := range []float64{0, 1} {
+		gamma := gamma
+		sc := &Scenario{
+			Name:     "selfish_revenue",
+			Seed:     1,
+			Duration: Duration(24 * time.Hour),
+			Network:  NetworkSpec{MinerNeighborRate: &rate, LatencySeconds: &latency},
+			// A practically infinite half-life keeps the genesis difficulty, and siblings tie.
+			Difficulty: DifficultySpec{Type: difficultyASERT, HalfLifeSeconds: 1e12},
+			Miners: []MinerSpec{
+				{Count: 6, HashrateDistribution: "equal", ConsensusAlgorithm: TD.String()},
+				{Name: "ff0000", Hashrate: 0.5, ConsensusAlgorithm: TD.String(), Selfish: &SelfishSpec{Gamma: &gamma}},
+			},
+		}
+		if err := sc.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		s := NewSimulation(sc.params())
+		err := s.run(runOptions{name: sc.Name, outDir: t.TempDir(), newMiners: sc.newMiners, skipPlots: true, logf: t.Logf})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := s.summary()
+		want := revenue(r.AttackerHashrateShare, gamma)
+		if math.Abs(r.AttackerShare-want) > 0.03 {
+			t.Errorf("gamma %v: relative revenue %0.3f want %0.3f", gamma, r.AttackerShare, want)
+		}
+	}
+}
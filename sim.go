@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"time"
+
+	exprand "golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Params are the parameters of a simulation.
+type Params struct {
+	// Seed drives all randomness in the simulation; the same seed and parameters
+	// produce identical block trees and stats. Zero picks a seed from the clock.
+	Seed int64
+
+	TicksPerSecond    int64 // resolution of block timestamps, which are in ticks
+	TickSamples       int64 // length of the simulation, in ticks
+	CountMiners       int64
+	MinerNeighborRate float64
+	Topology          TopologySpec
+	BlockReward       int64
+
+	LatencySeconds float64     // default block propagation latency; the median of lognormal latencies
+	Latency        LatencySpec // distribution of link latencies
+	BandwidthMbps  float64     // link bandwidth, which adds a block's transfer time to its latency; 0 is unlimited
+	BlockSizeBytes int64
+	DelaySeconds   float64 // default miner hesitancy to broadcast solution
+
+	TabsAdjustmentDenominator int64 // 4096 is the 'equilibrium' value, lower values prefer richer miners more (devaluing hashrate)
+	GenesisBlockTABS          int64 // tabs starting value
+
+	Difficulty DifficultySpec // the difficulty adjustment algorithm
+	Freshness  FreshnessSpec  // the TimeDesc fork choice's conditions
+}
+
+func DefaultParams() Params {
+	p := Params{
+		TicksPerSecond:            10,
+		CountMiners:               12,
+		MinerNeighborRate:         0.5, // 0.7
+		BlockReward:               3,
+		LatencySeconds:            1, // 1.23               // 2.5
+		DelaySeconds:              0,
+		TabsAdjustmentDenominator: 128, // 4096
+		GenesisBlockTABS:          10_000,
+	}
+	p.SetDuration(6 * time.Hour)
+	return p
+}
+
+// SetDuration sets TickSamples for the given length of simulated time.
+// It depends on TicksPerSecond, so set that first.
+func (p *Params) SetDuration(d time.Duration) {
+	p.TickSamples = p.TicksPerSecond * int64(d.Seconds())
+}
+
+func (p Params) Duration() time.Duration {
+	return time.Duration(p.TickSamples/p.TicksPerSecond) * time.Second
+}
+
+// seconds converts a time in ticks to seconds.
+func (p Params) seconds(ticks int64) float64 {
+	return float64(ticks) / float64(p.TicksPerSecond)
+}
+
+// Simulation owns the parameters and shared state of one simulated network.
+// Nothing in it is shared with other simulations, so independent simulations
+// can run side by side.
+type Simulation struct {
+	Params
+
+	// rand is the simulation's source for everything but TAB generation.
+	// It is not safe for concurrent use; a simulation runs on one goroutine.
+	rand *rand.Rand
+
+	// sched holds the simulation's clock and pending events.
+	sched scheduler
+
+	genesis *Block
+
+	// We'll use this for TAB score generation for each block.
+	// A normal distribution may not be the best fit. TODO.
+	normalDist distuv.Normal
+
+	// miners are the simulation's miners.
+	miners Miners
+
+	// doubleSpender is the strategy of the miner attempting a double spend, if any; it records the attack.
+	doubleSpender *doubleSpendStrategy
+
+	// txPoolBlockTABs holds the TAB drawn for the transactions available at each block number.
+	txPoolBlockTABs map[int64]int64
+}
+
+func NewSimulation(p Params) *Simulation {
+	if p.Seed == 0 {
+		p.Seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(p.Seed))
+	return &Simulation{
+		Params: p,
+		rand:   r,
+		genesis: &Block{
+			i:       0,
+			s:       0,
+			d:       big.NewInt(genesisDifficulty),
+			td:      big.NewInt(genesisDifficulty),
+			tabs:    p.GenesisBlockTABS,
+			ttdtabs: new(big.Int).Mul(big.NewInt(p.GenesisBlockTABS), big.NewInt(genesisDifficulty)),
+			miner:   "00F00F",
+			h:       fmt.Sprintf("%08x", r.Int63()),
+			ph:      "00000000",
+		},
+		normalDist: distuv.Normal{
+			Mu:    float64(p.GenesisBlockTABS),
+			Sigma: float64(p.GenesisBlockTABS) / 4, // I just made this up. TODO.
+			Src:   exprand.NewSource(uint64(p.Seed)),
+		},
+		txPoolBlockTABs: make(map[int64]int64),
+	}
+}
+
+// blockTxPoolTABs returns the TAB of the transactions available to blocks at number i,
+// drawing it the first time any miner asks.
+func (s *Simulation) blockTxPoolTABs(i int64) int64 {
+	tabs, ok := s.txPoolBlockTABs[i]
+	if !ok {
+		tabs = int64(s.normalDist.Rand())
+		s.txPoolBlockTABs[i] = tabs
+	}
+	return tabs
+}
+
+// newBlockHash returns a random (fake) block hash.
+func (s *Simulation) newBlockHash() string {
+	return fmt.Sprintf("%08x", s.rand.Int63())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSimulation_SideBySide(t *testing.T) {
+	sims := []*Simulation{}
+	for _, denominator := range []int64{64, 4096} {
+		p := DefaultParams()
+		p.CountMiners = 4
+		p.TabsAdjustmentDenominator = denominator
+		p.SetDuration(10 * time.Minute)
+		sims = append(sims, NewSimulation(p))
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(sims))
+	for i, sim := range sims {
+		wg.Add(1)
+		go func(i int, sim *Simulation) {
+			defer wg.Done()
+			errs[i] = sim.run(runOptions{
+				name:          "side_by_side",
+				outDir:        t.TempDir(),
+				minerMutation: func(m *Miner) { m.ConsensusAlgorithm = TDTABS },
+			})
+		}(i, sim)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sims[i].genesis == sims[(i+1)%len(sims)].genesis {
+			t.Fatal("simulations share a genesis block")
+		}
+		if len(sims[i].txPoolBlockTABs) == 0 {
+			t.Errorf("simulation %d mined no blocks", i)
+		}
+	}
+	if sims[0].TabsAdjustmentDenominator == sims[1].TabsAdjustmentDenominator {
+		t.Fatal("parameters leaked between simulations")
+	}
+}
+
+func TestSimulation_Reproducible(t *testing.T) {
+	run := func(seed int64) (trees, results []string) {
+		p := DefaultParams()
+		p.Seed = seed
+		p.CountMiners = 6
+		p.SetDuration(30 * time.Minute)
+		sim := NewSimulation(p)
+
+		var miners []*Miner
+		err := sim.run(runOptions{
+			name:   "reproducible",
+			outDir: t.TempDir(),
+			newMiners: func(s *Simulation, minerEvents chan minerEvent) []*Miner {
+				miners = s.minersNormal(minerEvents, func(m *Miner) {
+					m.ConsensusAlgorithm = TD
+				})
+				return miners
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range miners {
+			trees = append(trees, m.Blocks.String())
+			results = append(results, m.resultsLog())
+		}
+		return trees, results
+	}
+
+	treesA, resultsA := run(42)
+	treesB, resultsB := run(42)
+	for i := range treesA {
+		if treesA[i] != treesB[i] {
+			t.Fatalf("miner %d block trees differ for the same seed", i)
+		}
+		if resultsA[i] != resultsB[i] {
+			t.Fatalf("miner %d results differ for the same seed:\n%s\n%s", i, resultsA[i], resultsB[i])
+		}
+	}
+
+	treesC, _ := run(43)
+	if treesA[0] == treesC[0] {
+		t.Fatal("different seeds produced the same block tree")
+	}
+}
+
+// TestResultsLog_NoArbitrations checks that a miner that never arbitrated, nor reorganized, as a private miner
+// on its own chain, logs zeros for those, rather than NaN.
+func TestResultsLog_NoArbitrations(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.Strategy = StrategySpec{Type: strategyPrivate}.strategy(sim)
+	m.mine()
+	log := m.resultsLog()
+	if !strings.Contains(log, " objective_decs=0.000 arbs=0 reorgs.mag_mean=0.000 ") || strings.Contains(log, "NaN") {
+		t.Errorf("results log %q", log)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	strategyHonest      = "honest"
+	strategyDelay       = "delay"
+	strategySelfish     = "selfish"
+	strategyPrivate     = "private"
+	strategyDoubleSpend = "doubleSpend"
+	strategyEclipse     = "eclipse"
+)
+
+// A Strategy is how a miner deviates from the protocol, if it does: when it sends the blocks it mines
+// and relays, when it processes the blocks it receives, and which block it mines on.
+// The miner calls its hooks as things happen to it, and carries out the actions they return.
+// No actions is honest: send blocks at once, process them at once, and mine on the fork choice's head.
+type Strategy interface {
+	// BlockMined is called when the miner has mined b, before it processes it.
+	BlockMined(v MinerView, b *Block) []Action
+	// BlockReceived is called when b reaches the miner, before it processes it.
+	// Blocks can arrive more than once, over different links; v.Has tells whether the miner has b already.
+	BlockReceived(v MinerView, b *Block) []Action
+	// HeadChanged is called when processing a block has changed the miner's head.
+	HeadChanged(v MinerView, head *Block) []Action
+	// Tick is called as the network clock advances, before whatever happens at the new time.
+	Tick(v MinerView) []Action
+}
+
+// A Relayer is a Strategy that sends blocks to some neighbors differently from others,
+// as an eclipse attacker does its victim.
+type Relayer interface {
+	Strategy
+	// Relay returns how long from now the miner sends b to its neighbor to, where withhold is when it otherwise would:
+	// its Withhold action's, or +Inf if b is private. +Inf is never.
+	Relay(v MinerView, b *Block, to string, withhold float64) float64
+}
+
+type ActionKind int
+
+const (
+	// ActionPublish sends Block now, if it is private. A block the miner is about to process goes out as it does.
+	ActionPublish ActionKind = iota
+	// ActionWithhold sends Block, which the miner is about to process, at Until instead of at once.
+	// Until +Inf keeps it private, until it is published or released.
+	ActionWithhold
+	// ActionPostpone processes Block, which has just reached the miner, Seconds later.
+	ActionPostpone
+	// ActionSwitchParent mines on Block in place of the fork choice's head.
+	// Returned about a block the miner is about to process, it applies once the miner has processed it.
+	ActionSwitchParent
+	// ActionRelease sends Block and its private ancestors, oldest first, now.
+	ActionRelease
+)
+
+// Action is something a strategy has its miner do.
+type Action struct {
+	Kind    ActionKind
+	Block   *Block
+	Until   float64 // seconds since genesis
+	Seconds float64
+}
+
+func Publish(b *Block) Action {
+	return Action{Kind: ActionPublish, Block: b}
+}
+
+func WithholdUntil(b *Block, t float64) Action {
+	return Action{Kind: ActionWithhold, Block: b, Until: t}
+}
+
+func Postpone(b *Block, seconds float64) Action {
+	return Action{Kind: ActionPostpone, Block: b, Seconds: seconds}
+}
+
+func SwitchParent(b *Block) Action {
+	return Action{Kind: ActionSwitchParent, Block: b}
+}
+
+func Release(tip *Block) Action {
+	return Action{Kind: ActionRelease, Block: tip}
+}
+
+// MinerView is a strategy's read-only view of its miner, and of the network clock.
+// Blocks are shared by every miner, so strategies must not modify them either.
+type MinerView struct {
+	m *Miner
+}
+
+func (v MinerView) Address() string                        { return v.m.Address }
+func (v MinerView) Balance() int64                         { return v.m.Balance }
+func (v MinerView) ConsensusAlgorithm() ConsensusAlgorithm { return v.m.ConsensusAlgorithm }
+func (v MinerView) Head() *Block                           { return v.m.head }
+
+// Now is the network clock, in seconds since genesis.
+func (v MinerView) Now() float64 { return v.m.sim.sched.now }
+
+// Has tells whether the miner has processed b.
+func (v MinerView) Has(b *Block) bool { return v.m.Blocks.has(b) }
+
+// Private tells whether the miner withholds b until it publishes or releases it.
+func (v MinerView) Private(b *Block) bool { return math.IsInf(v.m.withheld[b.h], 1) }
+
+// Ancestor is b's ancestor (or b itself) with number i, or nil if the miner lacks it.
+func (v MinerView) Ancestor(b *Block, i int64) *Block { return v.m.Blocks.ancestorAt(b, i) }
+
+// Prefers tells whether the miner's fork choice prefers b to a, or, if it can't tell them apart, b is higher.
+func (v MinerView) Prefers(a, b *Block) bool {
+	if fc := v.m.ConsensusAlgorithm.ForkChoice(); fc != nil {
+		if winner, _ := fc.Choose(v.m, a, b); winner != nil {
+			return winner == b
+		}
+	}
+	return b.i > a.i
+}
+
+// TxPoolTABs is the TAB of the transactions available for block number i, or 0 if no miner has mined one yet.
+func (v MinerView) TxPoolTABs(i int64) int64 { return v.m.sim.txPoolBlockTABs[i] }
+
+// StrategySpec declares a miner's strategy, one of the built-ins by name. The zero value is honest.
+type StrategySpec struct {
+	Type string `json:"type"` // honest (default), delay, selfish, private, doubleSpend, eclipse
+
+	// SendDelay and ReceiveDelay are a delay miner's; unset, SendDelay is the simulation's DelaySeconds.
+	SendDelay    *DelayPolicy `json:"sendDelay"`
+	ReceiveDelay *DelayPolicy `json:"receiveDelay"`
+
+	// SelfishSpec is a selfish miner's variant.
+	SelfishSpec
+
+	// ReleaseAfter is when a private miner releases its chain. Zero is never.
+	ReleaseAfter Duration `json:"releaseAfter"`
+
+	// TxBlock is the number of the block with the merchant's transaction, which a doubleSpend miner forks below,
+	// and Confirmations the number of blocks, that one included, the merchant waits for.
+	// GiveUpBehind is how many blocks behind the public chain it abandons its fork
+	// (unset, doubleSpendGiveUpBehind; zero, never).
+	TxBlock       int64  `json:"txBlock"`
+	Confirmations int64  `json:"confirmations"`
+	GiveUpBehind  *int64 `json:"giveUpBehind"`
+
+	// Victim is the name of the miner an eclipse miner surrounds, and Occupy the share of the victim's links
+	// it takes over (unset, all of them). It drops the other miners' blocks on their way to the victim if Filter is set,
+	// or else delays them by VictimDelay; Feed has it mine a private chain for the victim, and the victim alone.
+	Victim      string       `json:"victim"`
+	Occupy      *float64     `json:"occupy"`
+	Filter      bool         `json:"filter"`
+	VictimDelay *DelayPolicy `json:"victimDelay"`
+	Feed        bool         `json:"feed"`
+}
+
+// strategies build each built-in strategy from its spec, by name.
+var strategies = map[string]func(spec StrategySpec, s *Simulation) Strategy{
+	strategyHonest: func(StrategySpec, *Simulation) Strategy { return honestStrategy{} },
+	strategyDelay: func(spec StrategySpec, s *Simulation) Strategy {
+		send := spec.SendDelay
+		if send == nil {
+			send = &DelayPolicy{Type: delayPolicyConstant, Seconds: s.DelaySeconds}
+		}
+		return &delayStrategy{send: send, receive: spec.ReceiveDelay}
+	},
+	strategySelfish: func(spec StrategySpec, _ *Simulation) Strategy {
+		return &selfishStrategy{SelfishSpec: spec.SelfishSpec}
+	},
+	strategyPrivate: func(spec StrategySpec, _ *Simulation) Strategy {
+		return &privateStrategy{releaseAt: time.Duration(spec.ReleaseAfter).Seconds()}
+	},
+	strategyDoubleSpend: func(spec StrategySpec, _ *Simulation) Strategy {
+		giveUp := int64(doubleSpendGiveUpBehind)
+		if spec.GiveUpBehind != nil {
+			giveUp = *spec.GiveUpBehind
+		}
+		return &doubleSpendStrategy{n: spec.TxBlock, z: spec.Confirmations, giveUp: giveUp}
+	},
+	strategyEclipse: func(spec StrategySpec, _ *Simulation) Strategy {
+		occupy := 1.0
+		if spec.Occupy != nil {
+			occupy = *spec.Occupy
+		}
+		return &eclipseStrategy{victim: spec.Victim, occupy: occupy, delay: spec.VictimDelay, filter: spec.Filter, feed: spec.Feed}
+	},
+}
+
+func (spec StrategySpec) typeName() string {
+	if spec.Type == "" {
+		return strategyHonest
+	}
+	return spec.Type
+}
+
+func (spec StrategySpec) validate() error {
+	if _, ok := strategies[spec.typeName()]; !ok {
+		return fmt.Errorf("unknown type %q (want one of %s)", spec.Type, strings.Join(strategyNames(), ", "))
+	}
+	t := spec.typeName()
+	if (spec.SendDelay != nil || spec.ReceiveDelay != nil) && t != strategyDelay {
+		return fmt.Errorf("sendDelay and receiveDelay only apply to %s", strategyDelay)
+	}
+	if err := spec.SendDelay.validate(); err != nil {
+		return fmt.Errorf("sendDelay: %w", err)
+	}
+	if err := spec.ReceiveDelay.validate(); err != nil {
+		return fmt.Errorf("receiveDelay: %w", err)
+	}
+	if spec.SelfishSpec != (SelfishSpec{}) && t != strategySelfish {
+		return fmt.Errorf("leadStubborn, equalForkStubborn, trailStubborn and gamma only apply to %s", strategySelfish)
+	}
+	if err := spec.SelfishSpec.validate(); err != nil {
+		return err
+	}
+	if spec.ReleaseAfter < 0 {
+		return errors.New("releaseAfter must not be negative")
+	}
+	if spec.ReleaseAfter != 0 && t != strategyPrivate {
+		return fmt.Errorf("releaseAfter only applies to %s", strategyPrivate)
+	}
+	if err := spec.validateEclipse(); err != nil {
+		return err
+	}
+	if t != strategyDoubleSpend {
+		if spec.TxBlock != 0 || spec.Confirmations != 0 || spec.GiveUpBehind != nil {
+			return fmt.Errorf("txBlock, confirmations and giveUpBehind only apply to %s", strategyDoubleSpend)
+		}
+		return nil
+	}
+	if spec.TxBlock < 1 {
+		return fmt.Errorf("txBlock must be positive, got %d", spec.TxBlock)
+	}
+	if spec.Confirmations < 1 {
+		return fmt.Errorf("confirmations must be positive, got %d", spec.Confirmations)
+	}
+	if spec.GiveUpBehind != nil && *spec.GiveUpBehind < 0 {
+		return fmt.Errorf("giveUpBehind must not be negative, got %d", *spec.GiveUpBehind)
+	}
+	return nil
+}
+
+func (spec StrategySpec) validateEclipse() error {
+	if spec.typeName() != strategyEclipse {
+		if spec.Victim != "" || spec.Occupy != nil || spec.Filter || spec.VictimDelay != nil || spec.Feed {
+			return fmt.Errorf("victim, occupy, filter, victimDelay and feed only apply to %s", strategyEclipse)
+		}
+		return nil
+	}
+	if spec.Victim == "" {
+		return errors.New("victim is required")
+	}
+	if spec.Occupy != nil && (*spec.Occupy < 0 || *spec.Occupy > 1) {
+		return fmt.Errorf("occupy must be between 0 and 1, got %v", *spec.Occupy)
+	}
+	if spec.Filter && spec.VictimDelay != nil {
+		return errors.New("filter cannot be combined with victimDelay")
+	}
+	if err := spec.VictimDelay.validate(); err != nil {
+		return fmt.Errorf("victimDelay: %w", err)
+	}
+	return nil
+}
+
+func (spec StrategySpec) strategy(s *Simulation) Strategy {
+	return strategies[spec.typeName()](spec, s)
+}
+
+func strategyNames() (names []string) {
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultStrategy is the strategy of miners configured without one: honest, but for the simulation's DelaySeconds.
+func (s *Simulation) defaultStrategy() Strategy {
+	if s.DelaySeconds > 0 {
+		return &delayStrategy{send: &DelayPolicy{Type: delayPolicyConstant, Seconds: s.DelaySeconds}}
+	}
+	return nil
+}
+
+// honestStrategy takes no actions. Other strategies embed it for the hooks they have no use for.
+type honestStrategy struct{}
+
+func (honestStrategy) BlockMined(MinerView, *Block) []Action    { return nil }
+func (honestStrategy) BlockReceived(MinerView, *Block) []Action { return nil }
+func (honestStrategy) HeadChanged(MinerView, *Block) []Action   { return nil }
+func (honestStrategy) Tick(MinerView) []Action                  { return nil }
+
+// delayStrategy sends blocks, its own and those it relays, after its send delay,
+// and processes the blocks it receives after its receive delay.
+type delayStrategy struct {
+	honestStrategy
+	send, receive *DelayPolicy
+}
+
+func (s *delayStrategy) BlockMined(v MinerView, b *Block) []Action {
+	if d := s.send.seconds(v, b); d > 0 {
+		return []Action{WithholdUntil(b, v.Now()+d)}
+	}
+	return nil
+}
+
+func (s *delayStrategy) BlockReceived(v MinerView, b *Block) (actions []Action) {
+	postpone := s.receive.seconds(v, b)
+	if postpone > 0 {
+		actions = append(actions, Postpone(b, postpone))
+	}
+	// The send delay runs from when the miner processes the block, and relays it.
+	if d := s.send.seconds(v, b); d > 0 {
+		actions = append(actions, WithholdUntil(b, v.Now()+postpone+d))
+	}
+	return actions
+}
+
+// privateStrategy mines a private chain, on its own blocks only, until the network clock reaches releaseAt.
+// Then it releases the chain, for the fork choices to weigh against the public one, and mines honestly.
+type privateStrategy struct {
+	honestStrategy
+	releaseAt float64 // zero is never
+	released  bool
+}
+
+func (s *privateStrategy) BlockMined(v MinerView, b *Block) []Action {
+	if s.released {
+		return nil
+	}
+	return []Action{WithholdUntil(b, math.Inf(1)), SwitchParent(b)}
+}
+
+func (s *privateStrategy) BlockReceived(v MinerView, b *Block) []Action {
+	if s.released {
+		return nil
+	}
+	return []Action{SwitchParent(v.Head())}
+}
+
+func (s *privateStrategy) Tick(v MinerView) []Action {
+	if s.released || s.releaseAt == 0 || v.Now() < s.releaseAt {
+		return nil
+	}
+	s.released = true
+	return []Action{Release(v.Head())}
+}
+
+// strategy is the miner's strategy, honest if it has none.
+func (m *Miner) strategy() Strategy {
+	if m.Strategy == nil {
+		return honestStrategy{}
+	}
+	return m.Strategy
+}
+
+func (m *Miner) view() MinerView {
+	return MinerView{m: m}
+}
+
+// act carries out the actions of the miner's strategy. b is the block the miner is about to process,
+// which the hook was about, or nil. act returns how long to postpone processing b.
+func (m *Miner) act(actions []Action, b *Block) (postpone float64) {
+	for _, a := range actions {
+		switch a.Kind {
+		case ActionPublish:
+			until, ok := m.withheld[a.Block.h]
+			if !m.Blocks.has(a.Block) {
+				delete(m.withheld, a.Block.h) // it goes out as the miner processes it
+			} else if ok && math.IsInf(until, 1) {
+				delete(m.withheld, a.Block.h)
+				m.broadcastBlock(a.Block)
+			}
+		case ActionWithhold:
+			// Only a block yet to be sent can be withheld; the first say on it stands.
+			if _, ok := m.withheld[a.Block.h]; ok || m.Blocks.has(a.Block) {
+				continue
+			}
+			if m.withheld == nil {
+				m.withheld = make(map[string]float64)
+			}
+			m.withheld[a.Block.h] = a.Until
+		case ActionPostpone:
+			if a.Block == b && a.Seconds > postpone {
+				postpone = a.Seconds
+			}
+		case ActionSwitchParent:
+			if b != nil {
+				if m.switches == nil {
+					m.switches = make(map[string]*Block)
+				}
+				m.switches[b.h] = a.Block
+			} else if m.Blocks.has(a.Block) {
+				m.setHead(a.Block)
+			}
+		case ActionRelease:
+			m.release(a.Block)
+		}
+	}
+	return postpone
+}
+
+// release sends tip and its private ancestors, oldest first.
+func (m *Miner) release(tip *Block) {
+	var chain []*Block
+	for b := tip; b != nil && math.IsInf(m.withheld[b.h], 1); b = m.Blocks.GetParent(b) {
+		chain = append(chain, b)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		delete(m.withheld, chain[i].h)
+		m.broadcastBlock(chain[i])
+	}
+}
+
+// tick lets the miner's strategy act on the network clock having advanced.
+func (m *Miner) tick() {
+	if m.Strategy != nil {
+		m.act(m.Strategy.Tick(m.view()), nil)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStrategy_Private(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.Strategy = StrategySpec{Type: strategyPrivate, ReleaseAfter: Duration(time.Minute)}.strategy(sim)
+	m.Latency = func(*Miner, *Block) float64 { return 0 }
+	neighbor := newTestMiner(t, sim, "00000b")
+	m.neighbors = []*Miner{neighbor}
+
+	sim.sched.now = 10
+	m.mine()
+	p1 := m.head
+	sim.sched.now = 20
+	m.mine()
+	p2 := m.head
+
+	// The miner keeps to its own chain, even when the public one is longer.
+	h1 := honestChild(sim, sim.genesis)
+	h2 := honestChild(sim, h1)
+	receive(m, h1)
+	receive(m, h2)
+	if m.head != p2 || neighbor.Blocks.has(p1) || neighbor.Blocks.has(p2) {
+		t.Fatalf("before release: head %v, published %v %v", m.head, neighbor.Blocks.has(p1), neighbor.Blocks.has(p2))
+	}
+
+	sim.sched.now = 59
+	m.tick()
+	if neighbor.Blocks.has(p1) {
+		t.Fatal("released early")
+	}
+	sim.sched.now = 60
+	m.tick()
+	if !neighbor.Blocks.has(p1) || !neighbor.Blocks.has(p2) {
+		t.Fatal("chain not released")
+	}
+
+	// Released, it mines honestly.
+	h3 := honestChild(sim, h2)
+	receive(m, h3)
+	if m.head != h3 {
+		t.Errorf("head %v want %v", m.head, h3)
+	}
+}
+
+// TestStrategy_PrivateOrphan checks that a withholding miner judges a block that waited for its parent
+// by its head once the block connects, not by its head when the block arrived.
+func TestStrategy_PrivateOrphan(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.Strategy = StrategySpec{Type: strategyPrivate}.strategy(sim)
+	sender := newTestMiner(t, sim, "00000b")
+	sender.Latency = func(*Miner, *Block) float64 { return 1 }
+	h1 := honestChild(sim, sim.genesis)
+	h2 := honestChild(sim, h1)
+	sender.processBlock(h1)
+	sender.processBlock(h2)
+
+	sim.sched.now = 10
+	m.mine()
+	p1 := m.head
+	m.receiveBlock(message{block: h2, from: sender})
+	if m.Blocks.has(h2) || m.Orphans != 1 {
+		t.Fatalf("h2 processed without its parent: orphans %d", m.Orphans)
+	}
+
+	// The miner extends its private chain while h1 is fetched.
+	sim.sched.now = 11
+	m.mine()
+	p2 := m.head
+	if p2.ph != p1.h {
+		t.Fatalf("p2 on %s want %s", p2.ph, p1.h)
+	}
+	for e := sim.sched.next(100); e != nil; e = sim.sched.next(100) {
+		if e.kind == eventDelivery {
+			e.miner.handleEvent(e)
+		}
+	}
+	if !m.Blocks.has(h1) || !m.Blocks.has(h2) {
+		t.Fatalf("h1 %v h2 %v not connected", m.Blocks.has(h1), m.Blocks.has(h2))
+	}
+	if m.head != p2 {
+		t.Errorf("head %v want %v", m.head, p2)
+	}
+}
+
+// stickyStrategy switches back to the head it had whenever processing a block changes it.
+type stickyStrategy struct {
+	honestStrategy
+	heads []*Block
+}
+
+func (s *stickyStrategy) HeadChanged(v MinerView, head *Block) []Action {
+	s.heads = append(s.heads, head)
+	return []Action{SwitchParent(v.Ancestor(head, 0))}
+}
+
+func TestStrategy_HeadChanged(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	s := &stickyStrategy{}
+	m.Strategy = s
+
+	b := honestChild(sim, sim.genesis)
+	receive(m, b)
+	if len(s.heads) != 1 || s.heads[0] != b {
+		t.Errorf("head changes %v want [%v]", s.heads, b)
+	}
+	if m.head != sim.genesis || m.Chain[b.i] != nil {
+		t.Errorf("head %v chain %v want genesis alone", m.head, m.Chain)
+	}
+}
+
+func TestStrategy_Withhold(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.Strategy = StrategySpec{Type: strategyDelay, SendDelay: &DelayPolicy{Type: delayPolicyConstant, Seconds: 30}}.strategy(sim)
+	m.Latency = func(*Miner, *Block) float64 { return 1 }
+	neighbor := newTestMiner(t, sim, "00000b")
+	m.neighbors = []*Miner{neighbor}
+
+	sim.sched.now = 10
+	m.mine()
+	b := m.head
+	var arrivals []float64
+	for e := sim.sched.next(100); e != nil; e = sim.sched.next(100) {
+		if e.kind == eventDelivery && e.msg.block == b && e.miner == neighbor {
+			arrivals = append(arrivals, e.at)
+		}
+	}
+	if len(arrivals) == 0 {
+		t.Fatal("block not sent")
+	}
+	for _, at := range arrivals {
+		if at != 41 {
+			t.Errorf("arrivals %v want at 41", arrivals)
+		}
+	}
+}
@@ -0,0 +1,798 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/montanaflynn/stats"
+)
+
+// Grid declares a parameter sweep: a base scenario, and values for each axis to vary.
+// Every combination of axis values is run once per seed.
+// Grids are loaded from JSON or YAML files, like scenarios.
+type Grid struct {
+	Name string `json:"name"`
+
+	// Scenario is the base scenario file, relative to the grid file.
+	Scenario string `json:"scenario"`
+
+	Seeds []int64 `json:"seeds"`
+
+	// SeedCount, in place of Seeds, runs seeds 1 to SeedCount, eg. to estimate a probability across many.
+	SeedCount int64 `json:"seedCount"`
+
+	// Axes maps an axis name (see sweepAxes) to the values it takes.
+	Axes map[string][]interface{} `json:"axes"`
+}
+
+// sweepAxes are the scenario parameters a grid can vary.
+var sweepAxes = map[string]func(sc *Scenario, v interface{}) error{
+	"consensusAlgorithm": func(sc *Scenario, v interface{}) error {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("want a string, got %v", v)
+		}
+		for i := range sc.Miners {
+			sc.Miners[i].ConsensusAlgorithm = s
+		}
+		return nil
+	},
+	"difficulty": func(sc *Scenario, v interface{}) error {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("want a string, got %v", v)
+		}
+		sc.Difficulty = DifficultySpec{Type: s}
+		for i := range sc.Miners {
+			sc.Miners[i].Difficulty = nil
+		}
+		return nil
+	},
+	"tieBreaker": func(sc *Scenario, v interface{}) error {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("want a string, got %v", v)
+		}
+		// The attackers' own tie breaking is part of their strategy; the axis varies everyone else's.
+		for i := range sc.Miners {
+			if !sc.Miners[i].attacker() {
+				sc.Miners[i].TieBreaker = s
+				sc.Miners[i].StrategySkipRandom = false
+			}
+		}
+		return nil
+	},
+	"hashrateDistribution": func(sc *Scenario, v interface{}) error {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("want a string, got %v", v)
+		}
+		for i := range sc.Miners {
+			if sc.Miners[i].Count > 1 {
+				sc.Miners[i].HashrateDistribution = s
+			}
+		}
+		return nil
+	},
+	"tabsAdjustmentDenominator": func(sc *Scenario, v interface{}) error {
+		f, ok := v.(float64)
+		if !ok || f != math.Trunc(f) {
+			return fmt.Errorf("want an integer, got %v", v)
+		}
+		sc.TABS.AdjustmentDenominator = int64(f)
+		return nil
+	},
+	"latencySeconds": func(sc *Scenario, v interface{}) error {
+		f, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("want a number, got %v", v)
+		}
+		sc.Network.LatencySeconds = &f
+		for i := range sc.Miners {
+			sc.Miners[i].LatencySeconds = nil
+		}
+		return nil
+	},
+	"latencySigma": func(sc *Scenario, v interface{}) error {
+		f, ok := v.(float64)
+		if !ok || f < 0 {
+			return fmt.Errorf("want a non-negative number, got %v", v)
+		}
+		l := &LatencySpec{Type: latencyLognormal, Sigma: f}
+		if sc.Network.Latency != nil {
+			l.PerMessage = sc.Network.Latency.PerMessage
+		}
+		sc.Network.Latency = l
+		return nil
+	},
+	"bandwidthMbps": func(sc *Scenario, v interface{}) error {
+		f, ok := v.(float64)
+		if !ok || f < 0 {
+			return fmt.Errorf("want a non-negative number, got %v", v)
+		}
+		sc.Network.BandwidthMbps = f
+		return nil
+	},
+	"freshnessTolerance": func(sc *Scenario, v interface{}) error {
+		f, ok := v.(float64)
+		if !ok || f < 0 {
+			return fmt.Errorf("want a non-negative number, got %v", v)
+		}
+		sc.Freshness.Tolerance = f
+		return nil
+	},
+	"attackerHashrate": func(sc *Scenario, v interface{}) error {
+		f, ok := v.(float64)
+		if !ok || f <= 0 {
+			return fmt.Errorf("want a positive number, got %v", v)
+		}
+		for i := range sc.Miners {
+			if sc.Miners[i].attacker() {
+				sc.Miners[i].Hashrate = f
+			}
+		}
+		return nil
+	},
+	"attackerDelaySeconds": func(sc *Scenario, v interface{}) error {
+		f, ok := v.(float64)
+		if !ok || f < 0 {
+			return fmt.Errorf("want a non-negative number, got %v", v)
+		}
+		for i := range sc.Miners {
+			if sc.Miners[i].attacker() {
+				sc.Miners[i].SendDelay = &DelayPolicy{Type: delayPolicyConstant, Seconds: f}
+			}
+		}
+		return nil
+	},
+	"selfishStrategy": func(sc *Scenario, v interface{}) error {
+		name, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("want a string, got %v", v)
+		}
+		var err error
+		setSelfish(sc, func(s *SelfishSpec) { err = s.parseStrategy(name) })
+		return err
+	},
+	"selfishGamma": func(sc *Scenario, v interface{}) error {
+		f, ok := v.(float64)
+		if !ok || f < 0 || f > 1 {
+			return fmt.Errorf("want a number between 0 and 1, got %v", v)
+		}
+		setSelfish(sc, func(s *SelfishSpec) { s.Gamma = &f })
+		return nil
+	},
+	"confirmations": func(sc *Scenario, v interface{}) error {
+		f, ok := v.(float64)
+		if !ok || f < 1 || f != math.Trunc(f) {
+			return fmt.Errorf("want a positive integer, got %v", v)
+		}
+		for i := range sc.Miners {
+			if st := sc.Miners[i].Strategy; st != nil && st.Type == strategyDoubleSpend {
+				c := *st
+				c.Confirmations = int64(f)
+				sc.Miners[i].Strategy = &c
+			}
+		}
+		return nil
+	},
+	"eclipseOccupy": func(sc *Scenario, v interface{}) error {
+		f, ok := v.(float64)
+		if !ok || f < 0 || f > 1 {
+			return fmt.Errorf("want a number between 0 and 1, got %v", v)
+		}
+		for i := range sc.Miners {
+			if st := sc.Miners[i].Strategy; st != nil && st.Type == strategyEclipse {
+				c := *st
+				c.Occupy = &f
+				sc.Miners[i].Strategy = &c
+			}
+		}
+		return nil
+	},
+	"minerNeighborRate": func(sc *Scenario, v interface{}) error {
+		f, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("want a number, got %v", v)
+		}
+		sc.Network.MinerNeighborRate = &f
+		return nil
+	},
+	"duration": func(sc *Scenario, v interface{}) error {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("want a string like \"6h\", got %v", v)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		sc.Duration = Duration(d)
+		return nil
+	},
+}
+
+// gridPoint is one run of a sweep: a scenario with one value set for each axis, and a seed.
+type gridPoint struct {
+	key          string
+	values       []string // in axis order
+	seed         int64
+	scenario     Scenario
+	scenarioHash string
+}
+
+// sweepResult is a finished grid point, as recorded in the checkpoint file.
+// ScenarioHash identifies the scenario it ran, so that resuming a sweep whose base scenario
+// has since changed runs the point again rather than keep a stale result.
+type sweepResult struct {
+	Key          string     `json:"key"`
+	Values       []string   `json:"values"`
+	Seed         int64      `json:"seed"`
+	ScenarioHash string     `json:"scenarioHash"`
+	Summary      runSummary `json:"summary"`
+}
+
+// scenarioHash identifies a grid point's scenario, axis values applied, by a hash of its JSON.
+func scenarioHash(sc Scenario) (string, error) {
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// setSelfish applies set to each selfish miner's spec, which it copies first, as clones share them.
+func setSelfish(sc *Scenario, set func(s *SelfishSpec)) {
+	for i := range sc.Miners {
+		ms := &sc.Miners[i]
+		switch {
+		case ms.Strategy != nil && ms.Strategy.Type == strategySelfish:
+			st := *ms.Strategy
+			set(&st.SelfishSpec)
+			ms.Strategy = &st
+		case ms.Selfish != nil:
+			s := *ms.Selfish
+			set(&s)
+			ms.Selfish = &s
+		}
+	}
+}
+
+// runSummary reduces a finished run's miners to network-level figures.
+type runSummary struct {
+	HeadMax                 int64   `json:"headMax"`
+	IntervalsMeanSeconds    float64 `json:"intervalsMeanSeconds"`
+	KMean                   float64 `json:"kMean"`
+	ReorgsMean              float64 `json:"reorgsMean"`
+	ReorgMagnitudesMean     float64 `json:"reorgMagnitudesMean"`
+	DecisiveArbitrationRate float64 `json:"decisiveArbitrationRate"`
+
+	// OrphansMean is the mean number of blocks per miner that arrived before their parent.
+	OrphansMean float64 `json:"orphansMean"`
+
+	// UncleRateMean is the mean number of uncles per canonical block.
+	UncleRateMean float64 `json:"uncleRateMean"`
+
+	// ReorgDepthMax is the most canonical blocks any honest miner lost in one reorg.
+	ReorgDepthMax int64 `json:"reorgDepthMax"`
+
+	// AttackerShare is the mean share of the honest miners' canonical blocks mined by attackers,
+	// and AttackerReorgs the mean number of reorgs per honest miner to a head an attacker mined.
+	AttackerShare  float64 `json:"attackerShare"`
+	AttackerReorgs float64 `json:"attackerReorgs"`
+
+	// AttackerHashrateShare is the attackers' share of the hashing power.
+	// An attack pays when it earns them a greater share of the blocks (AttackerShare, their relative revenue).
+	AttackerHashrateShare float64 `json:"attackerHashrateShare"`
+
+	// TopHashrate is the largest miner's hashrate, and TopWinRate its share of
+	// the canonical blocks in its own view.
+	TopHashrate float64 `json:"topHashrate"`
+	TopWinRate  float64 `json:"topWinRate"`
+
+	// DoubleSpendSuccess is 1 if a double spend succeeded, and DoubleSpendSeconds how long after the merchant
+	// accepted the payment every honest miner had replaced it; both are 0 if it failed.
+	// Their means over seeds are the success rate, and the mean time to success weighted by it.
+	// The other fields are the analytical success probabilities for the attackers' share of the hashing power
+	// (see nakamotoDoubleSpend and rosenfeldDoubleSpend); the simulated attacker premines no block,
+	// and, unlike theirs, gives up DoubleSpendGiveUpBehind blocks behind (zero is never) or at the end of the run,
+	// so the rates are not directly comparable.
+	DoubleSpendSuccess            float64 `json:"doubleSpendSuccess"`
+	DoubleSpendSeconds            float64 `json:"doubleSpendSeconds"`
+	DoubleSpendNakamoto           float64 `json:"doubleSpendNakamoto"`
+	DoubleSpendRosenfeld          float64 `json:"doubleSpendRosenfeld"`
+	DoubleSpendRosenfeldNoPremine float64 `json:"doubleSpendRosenfeldNoPremine"`
+	DoubleSpendGiveUpBehind       int64   `json:"doubleSpendGiveUpBehind"`
+
+	// VictimWasted is the share of an eclipse victim's blocks outside the honest chain, that of the honest miner
+	// (neither attacker nor victim) with the highest head, and VictimDivergence how many blocks apart
+	// the victim's head and the honest one are, counting both ways from their common ancestor.
+	VictimWasted     float64 `json:"victimWasted"`
+	VictimDivergence int64   `json:"victimDivergence"`
+}
+
+// runSummaryColumns are the CSV headers for runSummary, in field order.
+var runSummaryColumns = []string{"head_max", "intervals_mean", "k_mean", "reorgs_mean", "reorgs.mag_mean", "objective_decs", "orphans_mean", "uncle_rate", "reorgs.depth_max", "attacker_share", "attacker_reorgs", "attacker_hr_share", "top_hr", "top_winr", "ds_success", "ds_seconds", "ds_nakamoto", "ds_rosenfeld", "ds_rosenfeld_nopremine", "ds_give_up_behind", "victim_wasted", "victim_divergence"}
+
+func (r runSummary) row() []float64 {
+	return []float64{float64(r.HeadMax), r.IntervalsMeanSeconds, r.KMean, r.ReorgsMean, r.ReorgMagnitudesMean, r.DecisiveArbitrationRate, r.OrphansMean, r.UncleRateMean, float64(r.ReorgDepthMax), r.AttackerShare, r.AttackerReorgs, r.AttackerHashrateShare, r.TopHashrate, r.TopWinRate, r.DoubleSpendSuccess, r.DoubleSpendSeconds, r.DoubleSpendNakamoto, r.DoubleSpendRosenfeld, r.DoubleSpendRosenfeldNoPremine, float64(r.DoubleSpendGiveUpBehind), r.VictimWasted, float64(r.VictimDivergence)}
+}
+
+func (s *Simulation) summary() (r runSummary) {
+	var ks, intervals, reorgs, mags, decs, orphans, uncles []float64
+	var attackerShares, attackerReorgs []float64
+	var top *Miner
+	attackers := map[string]bool{}
+	var hashes, attackerHashes int64
+	for _, m := range s.miners {
+		hashes += m.HashesPerTick
+		if m.Attacker {
+			attackers[m.Address] = true
+			attackerHashes += m.HashesPerTick
+		}
+	}
+	if hashes > 0 {
+		r.AttackerHashrateShare = float64(attackerHashes) / float64(hashes)
+	}
+	for _, m := range s.miners {
+		if m.head.i > r.HeadMax {
+			r.HeadMax = m.head.i
+		}
+		k, _ := stats.Mean(m.Blocks.Ks())
+		ks = append(ks, k)
+		iv, _ := stats.Mean(m.Chain.Intervals())
+		intervals = append(intervals, iv/float64(s.TicksPerSecond))
+		reorgs = append(reorgs, float64(len(m.reorgs)))
+		orphans = append(orphans, float64(m.Orphans))
+		uncles = append(uncles, m.Chain.UncleRate())
+		mags = append(mags, m.reorgMagnitudes()...)
+		if m.ConsensusArbitrations > 0 {
+			decs = append(decs, float64(m.ConsensusObjectiveArbitrations)/float64(m.ConsensusArbitrations))
+		}
+		if top == nil || m.Hashrate > top.Hashrate {
+			top = m
+		}
+
+		if m.Attacker {
+			continue
+		}
+		if d := int64(m.reorgDepthMax()); d > r.ReorgDepthMax {
+			r.ReorgDepthMax = d
+		}
+		if len(attackers) == 0 {
+			continue
+		}
+		var blocks, reorgsTo int
+		for a := range attackers {
+			blocks += m.Chain.Wins(a)
+		}
+		for _, ro := range m.reorgs {
+			if attackers[ro.miner] {
+				reorgsTo++
+			}
+		}
+		if m.head.i > 0 {
+			attackerShares = append(attackerShares, float64(blocks)/float64(m.head.i))
+		}
+		attackerReorgs = append(attackerReorgs, float64(reorgsTo))
+	}
+	r.KMean, _ = stats.Mean(ks)
+	r.IntervalsMeanSeconds, _ = stats.Mean(intervals)
+	r.ReorgsMean, _ = stats.Mean(reorgs)
+	r.OrphansMean, _ = stats.Mean(orphans)
+	r.UncleRateMean, _ = stats.Mean(uncles)
+	// The means of no values are NaN, which JSON can't encode; leave them zero.
+	if len(mags) > 0 {
+		r.ReorgMagnitudesMean, _ = stats.Mean(mags)
+	}
+	if len(decs) > 0 {
+		r.DecisiveArbitrationRate, _ = stats.Mean(decs)
+	}
+	if len(attackerShares) > 0 {
+		r.AttackerShare, _ = stats.Mean(attackerShares)
+	}
+	if len(attackerReorgs) > 0 {
+		r.AttackerReorgs, _ = stats.Mean(attackerReorgs)
+	}
+	if top != nil && top.head.i > 0 {
+		wins := top.Chain.Wins(top.Address)
+		r.TopHashrate = top.Hashrate
+		r.TopWinRate = float64(wins) / float64(top.head.i)
+	}
+	if ds := s.doubleSpender; ds != nil {
+		if success, after := ds.result(s.miners); success {
+			r.DoubleSpendSuccess, r.DoubleSpendSeconds = 1, after
+		}
+		q := r.AttackerHashrateShare
+		r.DoubleSpendNakamoto = nakamotoDoubleSpend(q, ds.z)
+		r.DoubleSpendRosenfeld = rosenfeldDoubleSpend(q, ds.z, true)
+		r.DoubleSpendRosenfeldNoPremine = rosenfeldDoubleSpend(q, ds.z, false)
+		r.DoubleSpendGiveUpBehind = ds.giveUp
+	}
+	if victim, _ := s.eclipse(); victim != nil {
+		var honest *Miner
+		for _, m := range s.miners {
+			if !m.Attacker && m != victim && (honest == nil || m.head.i > honest.head.i) {
+				honest = m
+			}
+		}
+		if honest != nil {
+			r.VictimWasted, r.VictimDivergence = eclipseResult(victim, honest)
+		}
+	}
+	return r
+}
+
+// LoadGrid reads and validates a grid file, along with its base scenario.
+func LoadGrid(path string) (*Grid, *Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err = normalizeYAML(data, filepath.Ext(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("grid %s: %w", path, err)
+	}
+	g := &Grid{}
+	if err := decodeStrict(data, g); err != nil {
+		return nil, nil, fmt.Errorf("grid %s: %w", path, err)
+	}
+	if g.Name == "" {
+		g.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if g.Scenario == "" {
+		return nil, nil, fmt.Errorf("grid %s: scenario is required", path)
+	}
+	if g.SeedCount < 0 || g.SeedCount > 0 && len(g.Seeds) > 0 {
+		return nil, nil, fmt.Errorf("grid %s: seedCount must be positive, and cannot be combined with seeds", path)
+	}
+	for seed := int64(1); seed <= g.SeedCount; seed++ {
+		g.Seeds = append(g.Seeds, seed)
+	}
+	if len(g.Seeds) == 0 {
+		return nil, nil, fmt.Errorf("grid %s: seeds or seedCount is required", path)
+	}
+	seen := map[int64]bool{}
+	for _, seed := range g.Seeds {
+		if seed == 0 {
+			return nil, nil, fmt.Errorf("grid %s: seeds must be non-zero", path)
+		}
+		if seen[seed] {
+			return nil, nil, fmt.Errorf("grid %s: seed %d is listed more than once", path, seed)
+		}
+		seen[seed] = true
+	}
+	for _, name := range g.axisNames() {
+		values := g.Axes[name]
+		if _, ok := sweepAxes[name]; !ok {
+			return nil, nil, fmt.Errorf("grid %s: unknown axis %q (have %s)", path, name, strings.Join(sweepAxisNames(), ", "))
+		}
+		if len(values) == 0 {
+			return nil, nil, fmt.Errorf("grid %s: axis %s has no values", path, name)
+		}
+	}
+	scenarioPath := g.Scenario
+	if !filepath.IsAbs(scenarioPath) {
+		scenarioPath = filepath.Join(filepath.Dir(path), scenarioPath)
+	}
+	sc, err := LoadScenario(scenarioPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, sc, nil
+}
+
+func sweepAxisNames() (names []string) {
+	for name := range sweepAxes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// axisNames returns the grid's axes in a stable order.
+func (g *Grid) axisNames() (names []string) {
+	for name := range g.Axes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// points expands the grid into every combination of axis values and seeds,
+// validating the scenario of each.
+func (g *Grid) points(base *Scenario) ([]gridPoint, error) {
+	axes := g.axisNames()
+	var points []gridPoint
+
+	var expand func(axis int, sc Scenario, values []string) error
+	expand = func(axis int, sc Scenario, values []string) error {
+		if axis == len(axes) {
+			if err := sc.Validate(); err != nil {
+				return fmt.Errorf("%s: %w", strings.Join(values, ","), err)
+			}
+			hash, err := scenarioHash(sc)
+			if err != nil {
+				return fmt.Errorf("%s: %w", strings.Join(values, ","), err)
+			}
+			for _, seed := range g.Seeds {
+				kv := []string{}
+				for i, a := range axes {
+					kv = append(kv, a+"="+values[i])
+				}
+				kv = append(kv, "seed="+strconv.FormatInt(seed, 10))
+				points = append(points, gridPoint{
+					key:          strings.Join(kv, ","),
+					values:       values,
+					seed:         seed,
+					scenario:     sc,
+					scenarioHash: hash,
+				})
+			}
+			return nil
+		}
+		for _, v := range g.Axes[axes[axis]] {
+			next := sc.clone()
+			if err := sweepAxes[axes[axis]](&next, v); err != nil {
+				return fmt.Errorf("axis %s: %w", axes[axis], err)
+			}
+			nextValues := append(append([]string{}, values...), fmt.Sprintf("%v", v))
+			if err := expand(axis+1, next, nextValues); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := expand(0, base.clone(), nil); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// dirName is a filesystem-friendly version of the point's key.
+func (p gridPoint) dirName() string {
+	return strings.NewReplacer("=", "-", ",", "_", "/", "-").Replace(p.key)
+}
+
+type sweepOptions struct {
+	outDir  string
+	workers int
+	logf    func(format string, args ...interface{})
+}
+
+// runSweep runs every grid point not already recorded in the output directory's checkpoint file,
+// using a pool of workers, then writes the results tables.
+// An interrupted sweep continues where it stopped when run again with the same output directory.
+func runSweep(g *Grid, base *Scenario, opts sweepOptions) error {
+	logf := opts.logf
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+	if opts.workers < 1 {
+		return errors.New("workers must be at least 1")
+	}
+
+	points, err := g.points(base)
+	if err != nil {
+		return fmt.Errorf("grid %s: %w", g.Name, err)
+	}
+
+	if err := os.MkdirAll(opts.outDir, os.ModePerm); err != nil {
+		return err
+	}
+	checkpointPath := filepath.Join(opts.outDir, "checkpoint.jsonl")
+	done, err := readCheckpoint(checkpointPath)
+	if err != nil {
+		return err
+	}
+
+	todo := []gridPoint{}
+	for _, p := range points {
+		if r, ok := done[p.key]; !ok || r.ScenarioHash != p.scenarioHash {
+			todo = append(todo, p)
+		}
+	}
+	logf("Sweep %s: %d points, %d done, %d to run on %d workers", g.Name, len(points), len(points)-len(todo), len(todo), opts.workers)
+
+	checkpoint, err := os.OpenFile(checkpointPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer checkpoint.Close()
+
+	jobs := make(chan gridPoint)
+	results := make(chan sweepResult)
+	errs := make(chan error, opts.workers)
+	stop := make(chan struct{}) // closed when the collector fails
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				params := p.scenario.params()
+				params.Seed = p.seed
+				sim := NewSimulation(params)
+				sc := p.scenario.clone()
+				err := sim.run(runOptions{
+					name:      p.key,
+					outDir:    filepath.Join(opts.outDir, "runs", p.dirName()),
+					newMiners: sc.newMiners,
+					skipPlots: true,
+				})
+				if err != nil {
+					errs <- fmt.Errorf("%s: %w", p.key, err)
+					return
+				}
+				results <- sweepResult{Key: p.key, Values: p.values, Seed: p.seed, ScenarioHash: p.scenarioHash, Summary: sim.summary()}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, p := range todo {
+			select {
+			case jobs <- p:
+			case err := <-errs:
+				// Put it back for the collector, and stop handing out work.
+				errs <- err
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// On an error, keep draining the results, so that the workers finish their runs and exit.
+	var runErr error
+	for r := range results {
+		if runErr != nil {
+			continue
+		}
+		line, err := json.Marshal(r)
+		if err == nil {
+			_, err = checkpoint.Write(append(line, '\n'))
+		}
+		if err != nil {
+			runErr = fmt.Errorf("checkpoint: %w", err)
+			close(stop)
+			continue
+		}
+		done[r.Key] = r
+		logf("Done %s (%d/%d)", r.Key, len(done), len(points))
+	}
+	if runErr == nil {
+		select {
+		case runErr = <-errs:
+		default:
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+
+	if err := writeSweepTables(opts.outDir, g, points, done); err != nil {
+		return err
+	}
+	if len(points) > 0 && points[0].scenario.doubleSpends() {
+		logf("Sweep %s: ds_nakamoto and ds_rosenfeld* let the attacker catch up from any depth, at any time; "+
+			"ds_success gives up ds_give_up_behind blocks behind and at the end of each run, so it is not directly comparable with them", g.Name)
+	}
+	return nil
+}
+
+// readCheckpoint returns the results recorded by earlier runs of a sweep.
+// A truncated final line (from an interrupted write) is ignored.
+func readCheckpoint(path string) (map[string]sweepResult, error) {
+	done := map[string]sweepResult{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r sweepResult
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		done[r.Key] = r
+	}
+	return done, scanner.Err()
+}
+
+// writeSweepTables writes results.csv, with a row per grid point,
+// and aggregate.csv, with the mean over seeds for each combination of axis values.
+func writeSweepTables(outDir string, g *Grid, points []gridPoint, done map[string]sweepResult) error {
+	axes := g.axisNames()
+
+	header := append(append([]string{}, axes...), "seed")
+	header = append(header, runSummaryColumns...)
+	rows := [][]string{header}
+
+	type group struct {
+		values []string
+		rows   [][]float64
+	}
+	groups := []*group{}
+	byValues := map[string]*group{}
+
+	for _, p := range points {
+		r, ok := done[p.key]
+		if !ok {
+			continue
+		}
+		row := append(append([]string{}, p.values...), strconv.FormatInt(p.seed, 10))
+		for _, v := range r.Summary.row() {
+			row = append(row, strconv.FormatFloat(v, 'f', 4, 64))
+		}
+		rows = append(rows, row)
+
+		k := strings.Join(p.values, ",")
+		gr, ok := byValues[k]
+		if !ok {
+			gr = &group{values: p.values}
+			byValues[k] = gr
+			groups = append(groups, gr)
+		}
+		gr.rows = append(gr.rows, r.Summary.row())
+	}
+	if err := writeCSV(filepath.Join(outDir, "results.csv"), rows); err != nil {
+		return err
+	}
+
+	header = append(append([]string{}, axes...), "runs")
+	header = append(header, runSummaryColumns...)
+	rows = [][]string{header}
+	for _, gr := range groups {
+		row := append(append([]string{}, gr.values...), strconv.Itoa(len(gr.rows)))
+		for col := range runSummaryColumns {
+			var vs []float64
+			for _, r := range gr.rows {
+				vs = append(vs, r[col])
+			}
+			mean, _ := stats.Mean(vs)
+			row = append(row, strconv.FormatFloat(mean, 'f', 4, 64))
+		}
+		rows = append(rows, row)
+	}
+	return writeCSV(filepath.Join(outDir, "aggregate.csv"), rows)
+}
+
+func writeCSV(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
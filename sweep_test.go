@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunSweep_Checkpoint(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "base.yaml"), []byte(`
+duration: 5m
+miners:
+  - count: 4
+    hashrateDistribution: equal
+    consensusAlgorithm: TD
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gridPath := filepath.Join(dir, "grid.yaml")
+	if err := ioutil.WriteFile(gridPath, []byte(`
+scenario: base.yaml
+seeds: [1, 2]
+axes:
+  consensusAlgorithm: [TD, TDTABS]
+  tabsAdjustmentDenominator: [64, 4096]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g, base, err := LoadGrid(gridPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(dir, "out")
+
+	sweep := func() (ran int) {
+		err := runSweep(g, base, sweepOptions{
+			outDir:  outDir,
+			workers: 3,
+			logf: func(format string, args ...interface{}) {
+				if strings.HasPrefix(format, "Done") {
+					ran++
+				}
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ran
+	}
+
+	if ran := sweep(); ran != 8 {
+		t.Fatalf("ran=%d want=8", ran)
+	}
+	rows := readTestCSV(t, filepath.Join(outDir, "results.csv"))
+	if len(rows) != 9 {
+		t.Fatalf("results rows=%d want=9", len(rows))
+	}
+	if got := strings.Join(rows[0][:3], ","); got != "consensusAlgorithm,tabsAdjustmentDenominator,seed" {
+		t.Errorf("header=%s", got)
+	}
+	if rows := readTestCSV(t, filepath.Join(outDir, "aggregate.csv")); len(rows) != 5 {
+		t.Fatalf("aggregate rows=%d want=5", len(rows))
+	}
+
+	// A complete sweep has nothing left to do.
+	if ran := sweep(); ran != 0 {
+		t.Fatalf("ran=%d want=0", ran)
+	}
+
+	// Simulate an interruption: drop the last two points, and leave a torn line.
+	checkpoint := filepath.Join(outDir, "checkpoint.jsonl")
+	data, err := ioutil.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(strings.TrimSpace(string(data)), "\n")
+	torn := strings.Join(lines[:6], "") + "\n" + lines[6][:10]
+	if err := ioutil.WriteFile(checkpoint, []byte(torn), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ran := sweep(); ran != 2 {
+		t.Fatalf("ran=%d want=2", ran)
+	}
+	if rows := readTestCSV(t, filepath.Join(outDir, "results.csv")); len(rows) != 9 {
+		t.Fatalf("results rows=%d want=9", len(rows))
+	}
+
+	// Editing the base scenario makes every recorded result stale.
+	base.Duration = Duration(6 * time.Minute)
+	if ran := sweep(); ran != 8 {
+		t.Fatalf("after edit: ran=%d want=8", ran)
+	}
+	if rows := readTestCSV(t, filepath.Join(outDir, "results.csv")); len(rows) != 9 {
+		t.Fatalf("after edit: results rows=%d want=9", len(rows))
+	}
+}
+
+func TestLoadGrid_Files(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("sweeps", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no grid files")
+	}
+	for _, f := range files {
+		g, sc, err := LoadGrid(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.TrimSuffix(filepath.Base(f), ".yaml"); g.Name != want {
+			t.Errorf("%s: name=%s want=%s", f, g.Name, want)
+		}
+		if _, err := g.points(sc); err != nil {
+			t.Errorf("%s: %v", f, err)
+		}
+	}
+}
+
+func TestLoadGrid_UnknownAxis(t *testing.T) {
+	gridPath := filepath.Join(t.TempDir(), "grid.yaml")
+	if err := ioutil.WriteFile(gridPath, []byte(`{scenario: x.yaml, seeds: [1], axes: {hashrate: [1]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := LoadGrid(gridPath)
+	if err == nil || !strings.Contains(err.Error(), `unknown axis "hashrate"`) {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func readTestCSV(t *testing.T, path string) [][]string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
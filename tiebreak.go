@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TieBreaker names the policy by which a miner chooses between two blocks that neither its fork choice
+// nor their heights tell apart. A policy prefixed with selfFirst+ prefers the miner's own block,
+// and otherwise falls back to the policy it names.
+type TieBreaker string
+
+const (
+	TieLowestHash  TieBreaker = "lowestHash"
+	TieHighestHash TieBreaker = "highestHash"
+	TieFirstSeen   TieBreaker = "firstSeen"
+	TieRandom      TieBreaker = "random"
+	TieUniform     TieBreaker = "uniform"
+
+	tieSelfFirst = "selfFirst+"
+
+	// defaultTieBreaker is the policy of miners that don't set one.
+	defaultTieBreaker = tieSelfFirst + TieRandom
+)
+
+// tieBreakers are the policies a miner can be configured with, by name.
+// Each returns the block it prefers of a, the miner's incumbent head, and b, a block it has just received,
+// and the reason for the choice, which is tallied in the miner's decision conditions.
+var tieBreakers = map[TieBreaker]func(m *Miner, a, b *Block) (*Block, string){
+	TieLowestHash:  lowestHashTie,
+	TieHighestHash: highestHashTie,
+	TieFirstSeen:   firstSeenTie,
+	TieRandom:      randomTie,
+	TieUniform:     uniformTie,
+}
+
+func (t TieBreaker) String() string {
+	if t == "" {
+		return string(defaultTieBreaker)
+	}
+	return string(t)
+}
+
+// parseTieBreaker returns the policy named s, the default for "".
+func parseTieBreaker(s string) (TieBreaker, error) {
+	t := TieBreaker(s)
+	if _, ok := tieBreakers[TieBreaker(strings.TrimPrefix(t.String(), tieSelfFirst))]; !ok {
+		return "", fmt.Errorf("unknown tie breaker: %q (want one of %s, optionally prefixed with %s)", s, strings.Join(tieBreakerNames(), ", "), tieSelfFirst)
+	}
+	return t, nil
+}
+
+func tieBreakerNames() (names []string) {
+	for t := range tieBreakers {
+		names = append(names, string(t))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// breakTie chooses between a and b for miner m.
+func (t TieBreaker) breakTie(m *Miner, a, b *Block) (*Block, string) {
+	name := t.String()
+	if strings.HasPrefix(name, tieSelfFirst) {
+		if a.miner == m.Address && b.miner != m.Address {
+			return a, "miner_selfish"
+		} else if b.miner == m.Address && a.miner != m.Address {
+			return b, "miner_selfish"
+		}
+		name = strings.TrimPrefix(name, tieSelfFirst)
+	}
+	return tieBreakers[TieBreaker(name)](m, a, b)
+}
+
+func lowestHashTie(m *Miner, a, b *Block) (*Block, string) {
+	if b.h < a.h {
+		return b, "hash_low"
+	}
+	return a, "hash_low"
+}
+
+func highestHashTie(m *Miner, a, b *Block) (*Block, string) {
+	if b.h > a.h {
+		return b, "hash_high"
+	}
+	return a, "hash_high"
+}
+
+func firstSeenTie(m *Miner, a, b *Block) (*Block, string) {
+	return a, "first_seen"
+}
+
+// randomTie tosses a coin for each block that ties with the head, so when several arrive in turn,
+// the later ones are likelier to win.
+func randomTie(m *Miner, a, b *Block) (*Block, string) {
+	if m.sim.rand.Float64() < 0.5 {
+		return a, "random"
+	}
+	return b, "random"
+}
+
+// uniformTie is uniform tie breaking as in the selfish mining literature:
+// the miner mines on each of the k tied blocks it has seen with equal probability, 1/k.
+// Switching to the k-th tied block with probability 1/k keeps every block seen equally likely.
+func uniformTie(m *Miner, a, b *Block) (*Block, string) {
+	k := 0
+	for _, x := range m.Blocks[b.i] {
+		if x.h == a.h || x.h == b.h || m.ties(a, x) {
+			k++
+		}
+	}
+	if m.sim.rand.Float64() < 1/float64(k) {
+		return b, "uniform"
+	}
+	return a, "uniform"
+}
+
+// ties tells whether the miner's fork choice and block heights can't tell a and b apart.
+func (m *Miner) ties(a, b *Block) bool {
+	if a.i != b.i {
+		return false
+	}
+	if fc := m.ConsensusAlgorithm.ForkChoice(); fc != nil {
+		if winner, _ := fc.Choose(m, a, b); winner != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestTieBreaker(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+
+	mine := &Block{i: 1, td: big.NewInt(1), h: "0000000b", miner: m.Address}
+	low := &Block{i: 1, td: big.NewInt(1), h: "0000000a", miner: "00000f"}
+	high := &Block{i: 1, td: big.NewInt(1), h: "0000000c", miner: "00000f"}
+	for _, c := range []struct {
+		tb     TieBreaker
+		a, b   *Block
+		want   *Block
+		reason string
+	}{
+		{TieLowestHash, high, low, low, "hash_low"},
+		{TieLowestHash, mine, high, mine, "hash_low"},
+		{TieHighestHash, low, high, high, "hash_high"},
+		{TieFirstSeen, high, low, high, "first_seen"},
+		{tieSelfFirst + TieLowestHash, low, mine, mine, "miner_selfish"},
+		{tieSelfFirst + TieLowestHash, high, low, low, "hash_low"},
+		{"", low, mine, mine, "miner_selfish"},
+	} {
+		m.TieBreaker = c.tb
+		before := m.decisionConditionTallies[c.reason]
+		if got := m.arbitrateBlocks(c.a, c.b); got != c.want {
+			t.Errorf("%s: chose %s want %s", c.tb, got.h, c.want.h)
+		}
+		if m.decisionConditionTallies[c.reason] != before+1 {
+			t.Errorf("%s: %s not tallied: %v", c.tb, c.reason, m.decisionConditionTallies)
+		}
+	}
+
+	if _, err := parseTieBreaker("selfFirst+coin"); err == nil {
+		t.Error("parsed an unknown tie breaker")
+	}
+	for _, s := range []string{"", "uniform", "selfFirst+highestHash"} {
+		if _, err := parseTieBreaker(s); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// TestTieBreaker_Uniform checks that, of three tied blocks arriving in turn, uniform tie breaking
+// leaves the miner on each with probability 1/3, where a coin toss per arrival favors the last.
+func TestTieBreaker_Uniform(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	blocks := []*Block{
+		{i: 1, td: big.NewInt(1), h: "0000000a", miner: "00000f"},
+		{i: 1, td: big.NewInt(1), h: "0000000b", miner: "00000f"},
+		{i: 1, td: big.NewInt(1), h: "0000000c", miner: "00000f"},
+	}
+
+	const trials = 30000
+	heads := func(tb TieBreaker) map[*Block]float64 {
+		m.TieBreaker = tb
+		freq := map[*Block]float64{}
+		for n := 0; n < trials; n++ {
+			m.Blocks = NewBlockTree()
+			head := blocks[0]
+			m.Blocks.AppendBlockByNumber(head)
+			for _, b := range blocks[1:] {
+				m.Blocks.AppendBlockByNumber(b)
+				head = m.arbitrateBlocks(head, b)
+			}
+			freq[head] += 1.0 / trials
+		}
+		return freq
+	}
+
+	uniform := heads(TieUniform)
+	for _, b := range blocks {
+		if math.Abs(uniform[b]-1.0/3) > 0.02 {
+			t.Errorf("uniform: %s is the head in %0.3f of trials, want 1/3", b.h, uniform[b])
+		}
+	}
+	if random := heads(TieRandom); math.Abs(random[blocks[2]]-0.5) > 0.02 {
+		t.Errorf("random: the last block is the head in %0.3f of trials, want 1/2", random[blocks[2]])
+	}
+}
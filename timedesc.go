@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// TimeDesc is the freshness-preferred fork choice: of two blocks of about the same weight,
+// a miner prefers the fresher one, rather than tossing a coin.
+const TimeDesc ConsensusAlgorithm = "TimeDesc"
+
+const (
+	freshnessProduced = "produced"
+	freshnessReceived = "received"
+)
+
+// FreshnessSpec configures the TimeDesc fork choice.
+// The zero value judges freshness by block timestamps,
+// and prefers a fresher block only when it is at least as heavy as the other.
+type FreshnessSpec struct {
+	// By is what makes a block fresh: the time it was produced (its timestamp, the default),
+	// or the time the miner received it.
+	By string `json:"by"`
+
+	// Tolerance is how much less total difficulty a fresher block may have and still be preferred,
+	// in blocks of the incumbent head's difficulty.
+	Tolerance float64 `json:"tolerance"`
+}
+
+func (f FreshnessSpec) byName() string {
+	if f.By == "" {
+		return freshnessProduced
+	}
+	return f.By
+}
+
+func (f FreshnessSpec) validate() error {
+	switch f.byName() {
+	case freshnessProduced, freshnessReceived:
+	default:
+		return fmt.Errorf("by must be %q or %q, got %q", freshnessProduced, freshnessReceived, f.By)
+	}
+	if f.Tolerance < 0 {
+		return fmt.Errorf("tolerance must not be negative, got %v", f.Tolerance)
+	}
+	return nil
+}
+
+// timeDescForkChoice prefers the fresher of two blocks whose total difficulties are within the tolerance.
+// Beyond it, the heavier block wins. Between blocks as fresh as each other, the heavier one wins.
+type timeDescForkChoice struct{}
+
+func (timeDescForkChoice) Choose(m *Miner, a, b *Block) (*Block, string) {
+	f := m.sim.Freshness
+
+	margin, _ := new(big.Float).Mul(new(big.Float).SetInt(a.d), big.NewFloat(f.Tolerance)).Int(nil)
+	if a.td.Cmp(new(big.Int).Add(b.td, margin)) > 0 {
+		return a, "consensus_score_high"
+	} else if b.td.Cmp(new(big.Int).Add(a.td, margin)) > 0 {
+		return b, "consensus_score_high"
+	}
+
+	if f.byName() == freshnessReceived {
+		// The incumbent reached the miner (or was mined by it) before b, which has just arrived.
+		return b, "fresh"
+	}
+	if a.s > b.s {
+		return a, "fresh"
+	} else if b.s > a.s {
+		return b, "fresh"
+	}
+
+	return tdForkChoice{}.Choose(m, a, b)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestTimeDescForkChoice(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	m := newTestMiner(t, sim, "00000a")
+	m.ConsensusAlgorithm = TimeDesc
+
+	const d = 100
+	head := &Block{i: 2, s: 20, d: big.NewInt(d), td: big.NewInt(1000), h: "0000000a"}
+	fresh := &Block{i: 2, s: 30, d: big.NewInt(d), td: big.NewInt(990), h: "0000000b"}  // fresher, a little lighter
+	stale := &Block{i: 1, s: 40, d: big.NewInt(d), td: big.NewInt(900), h: "0000000c"}  // fresher, a block lighter
+	heavy := &Block{i: 2, s: 20, d: big.NewInt(d), td: big.NewInt(1010), h: "0000000d"} // as fresh, heavier
+	older := &Block{i: 2, s: 10, d: big.NewInt(d), td: big.NewInt(1000), h: "0000000e"} // staler, as heavy
+
+	for _, c := range []struct {
+		freshness FreshnessSpec
+		b, want   *Block
+		reason    string
+	}{
+		{FreshnessSpec{}, fresh, head, "consensus_score_high"},
+		{FreshnessSpec{Tolerance: 0.5}, fresh, fresh, "fresh"},
+		{FreshnessSpec{Tolerance: 0.5}, stale, head, "consensus_score_high"},
+		{FreshnessSpec{Tolerance: 1.5}, stale, stale, "fresh"},
+		{FreshnessSpec{Tolerance: 0.5}, heavy, heavy, "consensus_score_high"},
+		{FreshnessSpec{Tolerance: 0.5}, older, head, "fresh"},
+		{FreshnessSpec{By: freshnessReceived, Tolerance: 0.5}, older, older, "fresh"},
+		{FreshnessSpec{By: freshnessReceived}, fresh, head, "consensus_score_high"},
+	} {
+		sim.Freshness = c.freshness
+		winner, reason := TimeDesc.ForkChoice().Choose(m, head, c.b)
+		if winner != c.want || reason != c.reason {
+			t.Errorf("%+v %s: chose %s (%s) want %s (%s)", c.freshness, c.b.h, winner.h, reason, c.want.h, c.reason)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	topologyRandom         = "random" // each directed pair of miners are neighbors with probability minerNeighborRate
+	topologyErdosRenyi     = "erdosRenyi"
+	topologyRandomRegular  = "randomRegular"
+	topologyWattsStrogatz  = "wattsStrogatz"
+	topologyBarabasiAlbert = "barabasiAlbert"
+	topologyFull           = "full"
+	topologyEdgeList       = "edgeList"
+)
+
+// TopologySpec declares the network graph over which miners send each other blocks.
+// The zero value is the random topology.
+type TopologySpec struct {
+	Type string `json:"type"`
+
+	// P is the link probability of erdosRenyi graphs (default minerNeighborRate),
+	// and the rewiring probability of wattsStrogatz graphs.
+	P float64 `json:"p"`
+
+	// Degree is the degree of randomRegular graphs, the (even) number of ring neighbors
+	// of each miner in wattsStrogatz graphs, and the number of links each miner
+	// makes as it joins a barabasiAlbert graph.
+	Degree int `json:"degree"`
+
+	// File is the edge list of an edgeList graph: one pair of miner indexes per line,
+	// separated by whitespace, which are neighbors of each other.
+	// Blank lines and lines starting with # are ignored.
+	File string `json:"file"`
+}
+
+func (t TopologySpec) typeName() string {
+	if t.Type == "" {
+		return topologyRandom
+	}
+	return t.Type
+}
+
+func (t TopologySpec) validate() error {
+	if _, ok := topologies[t.typeName()]; !ok {
+		return fmt.Errorf("unknown type %q (want one of %s)", t.Type, strings.Join(topologyNames(), ", "))
+	}
+	if t.P < 0 || t.P > 1 {
+		return fmt.Errorf("p must be within [0,1], got %v", t.P)
+	}
+	if t.Degree < 0 {
+		return fmt.Errorf("degree must not be negative, got %d", t.Degree)
+	}
+	if (t.File != "") != (t.typeName() == topologyEdgeList) {
+		return fmt.Errorf("file is required for, and only used by, %s topologies", topologyEdgeList)
+	}
+	return nil
+}
+
+func topologyNames() (names []string) {
+	for name := range topologies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// graph holds the neighbors of each miner, by index.
+// A miner sends blocks to its neighbors; undirected graphs list each link both ways.
+type graph [][]int
+
+// topologyGenerator builds a graph of n miners.
+type topologyGenerator struct {
+	generate func(t TopologySpec, p Params, n int, r *rand.Rand) (graph, error)
+
+	// random generators are retried when they make a graph that is not connected.
+	random bool
+}
+
+var topologies = map[string]topologyGenerator{
+	topologyRandom:         {generate: randomGraph, random: true},
+	topologyErdosRenyi:     {generate: erdosRenyiGraph, random: true},
+	topologyRandomRegular:  {generate: randomRegularGraph, random: true},
+	topologyWattsStrogatz:  {generate: wattsStrogatzGraph, random: true},
+	topologyBarabasiAlbert: {generate: barabasiAlbertGraph, random: true},
+	topologyFull:           {generate: fullGraph},
+	topologyEdgeList:       {generate: edgeListGraph},
+}
+
+// topologyAttempts is the number of graphs a random generator may make to find a connected one.
+const topologyAttempts = 100
+
+// topology generates the simulation's graph of n miners, in which every miner can reach every other.
+func (s *Simulation) topology(n int) (graph, error) {
+	t := s.Topology
+	gen := topologies[t.typeName()]
+	if gen.generate == nil {
+		return nil, fmt.Errorf("unknown topology type %q", t.Type)
+	}
+	for attempt := 0; ; attempt++ {
+		g, err := gen.generate(t, s.Params, n, s.rand)
+		if err != nil {
+			return nil, fmt.Errorf("topology %s: %w", t.typeName(), err)
+		}
+		from, to, ok := g.connected()
+		if ok {
+			return g, nil
+		}
+		if !gen.random || attempt+1 == topologyAttempts {
+			return nil, fmt.Errorf("topology %s is not connected: miner %d cannot reach miner %d", t.typeName(), from, to)
+		}
+	}
+}
+
+func newGraph(n int) graph {
+	return make(graph, n)
+}
+
+func (g graph) has(a, b int) bool {
+	for _, v := range g[a] {
+		if v == b {
+			return true
+		}
+	}
+	return false
+}
+
+// link makes a and b neighbors of each other.
+func (g graph) link(a, b int) {
+	if a == b || g.has(a, b) {
+		return
+	}
+	g[a] = append(g[a], b)
+	g[b] = append(g[b], a)
+}
+
+func (g graph) unlink(a, b int) {
+	g.drop(a, b)
+	g.drop(b, a)
+}
+
+// drop removes b from a's neighbors, leaving a among b's if it is.
+func (g graph) drop(a, b int) {
+	for i, u := range g[a] {
+		if u == b {
+			g[a] = append(g[a][:i], g[a][i+1:]...)
+			return
+		}
+	}
+}
+
+// randomGraph links each directed pair of miners with probability minerNeighborRate.
+func randomGraph(_ TopologySpec, p Params, n int, r *rand.Rand) (graph, error) {
+	g := newGraph(n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if i == j {
+				continue
+			}
+			if r.Float64() < p.MinerNeighborRate {
+				g[i] = append(g[i], j)
+			}
+		}
+	}
+	return g, nil
+}
+
+// erdosRenyiGraph links each pair of miners with probability t.P, both ways.
+func erdosRenyiGraph(t TopologySpec, p Params, n int, r *rand.Rand) (graph, error) {
+	rate := t.P
+	if rate == 0 {
+		rate = p.MinerNeighborRate
+	}
+	g := newGraph(n)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if r.Float64() < rate {
+				g.link(i, j)
+			}
+		}
+	}
+	return g, nil
+}
+
+// randomRegularGraph gives every miner t.Degree neighbors, chosen uniformly by the pairing model:
+// each miner gets t.Degree stubs, and the shuffled stubs are paired off,
+// starting over whenever a pair would make a loop or a double link.
+func randomRegularGraph(t TopologySpec, _ Params, n int, r *rand.Rand) (graph, error) {
+	d := t.Degree
+	if d < 1 || d >= n {
+		return nil, fmt.Errorf("degree must be within [1,%d], got %d", n-1, d)
+	}
+	if n*d%2 != 0 {
+		return nil, fmt.Errorf("miners times degree must be even, got %d*%d", n, d)
+	}
+	stubs := make([]int, 0, n*d)
+	for attempt := 0; attempt < 1000; attempt++ {
+		stubs = stubs[:0]
+		for i := 0; i < n; i++ {
+			for k := 0; k < d; k++ {
+				stubs = append(stubs, i)
+			}
+		}
+		r.Shuffle(len(stubs), func(i, j int) { stubs[i], stubs[j] = stubs[j], stubs[i] })
+
+		g := newGraph(n)
+		ok := true
+		for i := 0; i < len(stubs); i += 2 {
+			a, b := stubs[i], stubs[i+1]
+			if a == b || g.has(a, b) {
+				ok = false
+				break
+			}
+			g.link(a, b)
+		}
+		if ok {
+			return g, nil
+		}
+	}
+	return nil, errors.New("could not pair off links without loops or double links")
+}
+
+// wattsStrogatzGraph builds a small world: a ring in which every miner is linked to its t.Degree nearest miners,
+// then each link is rewired, with probability t.P, to a uniformly chosen miner.
+func wattsStrogatzGraph(t TopologySpec, _ Params, n int, r *rand.Rand) (graph, error) {
+	k := t.Degree
+	if k < 2 || k%2 != 0 || k >= n {
+		return nil, fmt.Errorf("degree must be even and within [2,%d], got %d", n-1, k)
+	}
+	g := newGraph(n)
+	for i := 0; i < n; i++ {
+		for j := 1; j <= k/2; j++ {
+			g.link(i, (i+j)%n)
+		}
+	}
+	for j := 1; j <= k/2; j++ {
+		for i := 0; i < n; i++ {
+			b := (i + j) % n
+			if r.Float64() >= t.P || !g.has(i, b) || len(g[i]) == n-1 {
+				continue
+			}
+			u := r.Intn(n)
+			for u == i || g.has(i, u) {
+				u = r.Intn(n)
+			}
+			g.unlink(i, b)
+			g.link(i, u)
+		}
+	}
+	return g, nil
+}
+
+// barabasiAlbertGraph grows a scale-free graph: starting from t.Degree+1 fully linked miners,
+// each further miner links to t.Degree distinct miners chosen with probability proportional to their degree.
+func barabasiAlbertGraph(t TopologySpec, _ Params, n int, r *rand.Rand) (graph, error) {
+	m := t.Degree
+	if m < 1 || m >= n {
+		return nil, fmt.Errorf("degree must be within [1,%d], got %d", n-1, m)
+	}
+	g := newGraph(n)
+	// ends lists each miner once per link it has, so a uniform pick from it is a pick by degree.
+	var ends []int
+	for i := 0; i <= m; i++ {
+		for j := i + 1; j <= m; j++ {
+			g.link(i, j)
+			ends = append(ends, i, j)
+		}
+	}
+	for v := m + 1; v < n; v++ {
+		var targets []int
+		for len(targets) < m {
+			u := ends[r.Intn(len(ends))]
+			if !g.has(v, u) {
+				g.link(v, u)
+				targets = append(targets, u)
+			}
+		}
+		for _, u := range targets {
+			ends = append(ends, v, u)
+		}
+	}
+	return g, nil
+}
+
+func fullGraph(_ TopologySpec, _ Params, n int, _ *rand.Rand) (graph, error) {
+	g := newGraph(n)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			g.link(i, j)
+		}
+	}
+	return g, nil
+}
+
+func edgeListGraph(t TopologySpec, _ Params, n int, _ *rand.Rand) (graph, error) {
+	f, err := os.Open(t.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g := newGraph(n)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want two miner indexes, got %q", t.File, line, text)
+		}
+		var ends [2]int
+		for i, field := range fields {
+			v, err := strconv.Atoi(field)
+			if err != nil || v < 0 || v >= n {
+				return nil, fmt.Errorf("%s:%d: miner index must be within [0,%d], got %q", t.File, line, n-1, field)
+			}
+			ends[i] = v
+		}
+		g.link(ends[0], ends[1])
+	}
+	return g, sc.Err()
+}
+
+// distances returns the number of hops from miner a to every miner, or -1 for those it cannot reach.
+func (g graph) distances(a int) []int {
+	dist := make([]int, len(g))
+	for i := range dist {
+		dist[i] = -1
+	}
+	dist[a] = 0
+	queue := []int{a}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, v := range g[u] {
+			if dist[v] < 0 {
+				dist[v] = dist[u] + 1
+				queue = append(queue, v)
+			}
+		}
+	}
+	return dist
+}
+
+// connected tells whether every miner can reach every other, and if not, a pair that cannot.
+func (g graph) connected() (from, to int, ok bool) {
+	for a := range g {
+		for b, d := range g.distances(a) {
+			if d < 0 {
+				return a, b, false
+			}
+		}
+	}
+	return 0, 0, true
+}
+
+// graphMetrics describe a (connected) graph.
+type graphMetrics struct {
+	Miners int
+	Links  int // directed; an undirected link counts twice
+
+	DegreeMin  int
+	DegreeMax  int
+	DegreeMean float64
+	Degrees    map[int]int // number of miners by (out) degree
+
+	Diameter       int     // the longest shortest path, in hops
+	PathLengthMean float64 // the mean shortest path between distinct miners, in hops
+}
+
+func (g graph) metrics() graphMetrics {
+	gm := graphMetrics{
+		Miners:    len(g),
+		DegreeMin: len(g),
+		Degrees:   make(map[int]int),
+	}
+	paths, pathsTotal := 0, 0
+	for a, neighbors := range g {
+		d := len(neighbors)
+		gm.Links += d
+		gm.Degrees[d]++
+		if d < gm.DegreeMin {
+			gm.DegreeMin = d
+		}
+		if d > gm.DegreeMax {
+			gm.DegreeMax = d
+		}
+		for b, hops := range g.distances(a) {
+			if b == a || hops < 0 {
+				continue
+			}
+			paths++
+			pathsTotal += hops
+			if hops > gm.Diameter {
+				gm.Diameter = hops
+			}
+		}
+	}
+	if len(g) > 0 {
+		gm.DegreeMean = float64(gm.Links) / float64(len(g))
+	}
+	if paths > 0 {
+		gm.PathLengthMean = float64(pathsTotal) / float64(paths)
+	}
+	return gm
+}
+
+func (gm graphMetrics) String() string {
+	degrees := make([]int, 0, len(gm.Degrees))
+	for d := range gm.Degrees {
+		degrees = append(degrees, d)
+	}
+	sort.Ints(degrees)
+	dist := make([]string, len(degrees))
+	for i, d := range degrees {
+		dist[i] = fmt.Sprintf("%d:%d", d, gm.Degrees[d])
+	}
+	return fmt.Sprintf("miners=%d links=%d degree_mean=%0.2f degree_min=%d degree_max=%d diameter=%d path_mean=%0.3f degrees=%s",
+		gm.Miners, gm.Links, gm.DegreeMean, gm.DegreeMin, gm.DegreeMax, gm.Diameter, gm.PathLengthMean, strings.Join(dist, ","))
+}
+
+// edgeList formats the graph's (directed) links, one per line.
+func (g graph) edgeList() string {
+	var out strings.Builder
+	for a, neighbors := range g {
+		for _, b := range neighbors {
+			fmt.Fprintf(&out, "%d %d\n", a, b)
+		}
+	}
+	return out.String()
+}
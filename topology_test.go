@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTopologies(t *testing.T) {
+	const n = 30
+	cases := []struct {
+		spec  TopologySpec
+		check func(t *testing.T, g graph, gm graphMetrics)
+	}{
+		{TopologySpec{}, nil},
+		{TopologySpec{Type: topologyErdosRenyi, P: 0.2}, nil},
+		{TopologySpec{Type: topologyRandomRegular, Degree: 3}, func(t *testing.T, g graph, gm graphMetrics) {
+			if gm.DegreeMin != 3 || gm.DegreeMax != 3 {
+				t.Errorf("degrees=%v", gm.Degrees)
+			}
+		}},
+		{TopologySpec{Type: topologyWattsStrogatz, Degree: 4, P: 0.2}, func(t *testing.T, g graph, gm graphMetrics) {
+			// Rewiring keeps the number of links.
+			if gm.Links != n*4 {
+				t.Errorf("links=%d want=%d", gm.Links, n*4)
+			}
+		}},
+		{TopologySpec{Type: topologyWattsStrogatz, Degree: 4}, func(t *testing.T, g graph, gm graphMetrics) {
+			// Without rewiring, it is a ring lattice.
+			if gm.DegreeMin != 4 || gm.DegreeMax != 4 || gm.Diameter != 8 { // 15 miners away at most, 2 at a hop
+				t.Errorf("%v", gm)
+			}
+		}},
+		{TopologySpec{Type: topologyBarabasiAlbert, Degree: 2}, func(t *testing.T, g graph, gm graphMetrics) {
+			// A clique of 3, then 2 links per joining miner.
+			if want := 2*3 + 2*2*(n-3); gm.Links != want {
+				t.Errorf("links=%d want=%d", gm.Links, want)
+			}
+			if gm.DegreeMin < 2 {
+				t.Errorf("degree_min=%d", gm.DegreeMin)
+			}
+		}},
+		{TopologySpec{Type: topologyFull}, func(t *testing.T, g graph, gm graphMetrics) {
+			if gm.Diameter != 1 || gm.Links != n*(n-1) {
+				t.Errorf("%v", gm)
+			}
+		}},
+	}
+	for _, c := range cases {
+		p := DefaultParams()
+		p.Seed = 1
+		p.Topology = c.spec
+		g, err := NewSimulation(p).topology(n)
+		if err != nil {
+			t.Fatalf("%s: %v", c.spec.typeName(), err)
+		}
+		if _, _, ok := g.connected(); !ok {
+			t.Fatalf("%s: not connected", c.spec.typeName())
+		}
+		for a := range g {
+			for _, b := range g[a] {
+				if a == b {
+					t.Fatalf("%s: miner %d is its own neighbor", c.spec.typeName(), a)
+				}
+				if c.spec.typeName() != topologyRandom && !g.has(b, a) {
+					t.Fatalf("%s: link %d-%d is one way", c.spec.typeName(), a, b)
+				}
+			}
+		}
+		gm := g.metrics()
+		t.Logf("%s: %v", c.spec.typeName(), gm)
+		if c.check != nil {
+			c.check(t, g, gm)
+		}
+
+		// Same seed, same graph.
+		again, _ := NewSimulation(p).topology(n)
+		if !reflect.DeepEqual(g, again) {
+			t.Errorf("%s: not reproducible", c.spec.typeName())
+		}
+	}
+}
+
+func TestTopology_EdgeList(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "path.txt")
+	if err := ioutil.WriteFile(f, []byte("# a path\n0 1\n1 2\n\n2 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := edgeListGraph(TopologySpec{Type: topologyEdgeList, File: f}, Params{}, 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gm := g.metrics()
+	if gm.Diameter != 3 || gm.Links != 6 || gm.DegreeMin != 1 || gm.DegreeMax != 2 {
+		t.Fatalf("%v", gm)
+	}
+	// 12 ordered pairs: 6 at 1 hop, 4 at 2, 2 at 3.
+	if gm.PathLengthMean != 20.0/12 {
+		t.Fatalf("path_mean=%v", gm.PathLengthMean)
+	}
+
+	p := Params{Topology: TopologySpec{Type: topologyEdgeList, File: f}}
+	s := &Simulation{Params: p, rand: rand.New(rand.NewSource(1))}
+	if _, err := s.topology(5); err == nil || !strings.Contains(err.Error(), "not connected") {
+		t.Fatalf("err=%v", err)
+	}
+	if _, err := s.topology(3); err == nil || !strings.Contains(err.Error(), "miner index must be within [0,2]") {
+		t.Fatalf("err=%v", err)
+	}
+}
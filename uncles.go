@@ -0,0 +1,107 @@
+package main
+
+// Uncles (ommers) are blocks that lost a fork but whose work a later block acknowledges, as in Ethereum.
+// A block may include up to unclesPerBlockMax uncles: blocks whose parent is one of the block's ancestors,
+// up to uncleDepthMax generations back, which are not themselves ancestors, nor included already.
+// The uncle's miner is paid part of the block reward, the less the older the uncle,
+// and the including (nephew) miner a small bonus per uncle.
+// Rewards are counted in sub-units, rewardSubunits to a unit of BlockReward, so that those fractions
+// (7/8 to 2/8 for an uncle, 1/32 for a nephew) come out exact however small the block reward;
+// miners' balances take them in whole units.
+
+const (
+	uncleDepthMax     = 6
+	unclesPerBlockMax = 2
+
+	rewardSubunits = 32
+)
+
+// blockReward is the reward for mining a block, in sub-units.
+func (p Params) blockReward() int64 {
+	return p.BlockReward * rewardSubunits
+}
+
+// uncleReward is the reward for uncle u's miner, when u is included by nephew, in sub-units.
+func (p Params) uncleReward(u, nephew *Block) int64 {
+	return p.blockReward() * (u.i + 8 - nephew.i) / 8
+}
+
+// nephewReward is the reward for including an uncle, on top of the block reward, in sub-units.
+func (p Params) nephewReward() int64 {
+	return p.blockReward() / 32
+}
+
+// rewards are what canonical block b pays address, in sub-units, as its miner or the miner of one of its uncles.
+// The second value is the part paid for uncles.
+func (p Params) rewards(b *Block, address string) (total, uncle int64) {
+	if b.miner == address {
+		total += p.blockReward() + int64(len(b.uncles))*p.nephewReward()
+	}
+	for _, u := range b.uncles {
+		if u.miner == address {
+			r := p.uncleReward(u, b)
+			total += r
+			uncle += r
+		}
+	}
+	return total, uncle
+}
+
+// eligibleUncles returns the uncles the miner includes in a block on parent, which is the miner's head:
+// the nearest eligible side blocks it knows of.
+func (m *Miner) eligibleUncles(parent *Block) (uncles []*Block) {
+	i := parent.i + 1
+
+	// Uncles can't be included twice.
+	included := map[string]bool{}
+	for b, n := parent, 0; b != nil && n < uncleDepthMax; b, n = m.Chain[b.i-1], n+1 {
+		for _, u := range b.uncles {
+			included[u.h] = true
+		}
+	}
+
+	for j := i - 1; j >= i-uncleDepthMax && j >= 1; j-- {
+		for _, u := range m.Blocks[j] {
+			if m.Chain[j] == u || included[u.h] {
+				continue
+			}
+			if ancestor := m.Chain[j-1]; ancestor == nil || u.ph != ancestor.h {
+				continue
+			}
+			uncles = append(uncles, u)
+			if len(uncles) == unclesPerBlockMax {
+				return uncles
+			}
+		}
+	}
+	return uncles
+}
+
+// UncleRate is the number of uncles the chain's blocks include, per block.
+func (c Chain) UncleRate() float64 {
+	var blocks, uncles int
+	for i, b := range c {
+		if i == 0 {
+			continue
+		}
+		blocks++
+		uncles += len(b.uncles)
+	}
+	if blocks == 0 {
+		return 0
+	}
+	return float64(uncles) / float64(blocks)
+}
+
+// Rewards sums what the chain pays address, and the part of it paid for uncles, in sub-units.
+func (c Chain) Rewards(p Params, address string) (total, uncle int64) {
+	for i, b := range c {
+		if i == 0 {
+			continue
+		}
+		t, u := p.rewards(b, address)
+		total += t
+		uncle += u
+	}
+	return total, uncle
+}
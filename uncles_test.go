@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+func TestUncles(t *testing.T) {
+	sim := NewSimulation(DefaultParams())
+	sim.BlockReward = 32
+	m := newTestMiner(t, sim, "00000a")
+
+	child := func(parent *Block, d int64, miner string) *Block {
+		b := childBlock(parent, d, sim.newBlockHash())
+		b.miner = miner
+		m.processBlock(b)
+		return b
+	}
+	g := sim.genesis
+	a1 := child(g, 200, "00000b")
+	u1 := child(g, 100, m.Address) // the miner's own uncle
+	a2 := child(a1, 200, "00000b")
+	u2 := child(a1, 100, "00000c")
+	child(u1, 100, "00000c") // its parent is not canonical
+	if m.head != a2 {
+		t.Fatalf("head %v want %v", m.head, a2)
+	}
+
+	uncles := m.eligibleUncles(a2)
+	if len(uncles) != 2 || uncles[0] != u2 || uncles[1] != u1 {
+		t.Fatalf("uncles %v want [%v %v]", uncles, u2, u1)
+	}
+
+	m.mine()
+	nephew := m.head
+	if nephew.i != 3 || len(nephew.uncles) != 2 {
+		t.Fatalf("mined %v with uncles %v", nephew, nephew.uncles)
+	}
+	// The block reward, a nephew reward per uncle, and the reward for u1, two generations back.
+	if want := int64(32 + 2*1 + 32*6/8); m.Balance != want {
+		t.Errorf("balance %d want %d", m.Balance, want)
+	}
+	if total, uncle := m.Chain.Rewards(sim.Params, m.Address); total != m.Balance*rewardSubunits || uncle != 24*rewardSubunits {
+		t.Errorf("rewards %d (uncle %d) want %d (%d)", total, uncle, m.Balance*rewardSubunits, 24*rewardSubunits)
+	}
+	if got := m.Chain.UncleRate(); got != 2.0/3 {
+		t.Errorf("uncle rate %v want 2/3", got)
+	}
+
+	// Included uncles are not eligible again, and side blocks too deep never are.
+	if uncles := m.eligibleUncles(nephew); len(uncles) != 0 {
+		t.Errorf("uncles %v included twice", uncles)
+	}
+	head := nephew
+	for i := 0; i < uncleDepthMax; i++ {
+		head = child(head, 200, "00000b")
+	}
+	child(a1, 100, "00000d")
+	if uncles := m.eligibleUncles(head); len(uncles) != 0 {
+		t.Errorf("uncles %v deeper than %d", uncles, uncleDepthMax)
+	}
+}
+
+// TestUncles_DefaultRewards checks that the default block reward, too small to divide by 32 in whole units,
+// still pays exact uncle and nephew rewards, and that miners' balances take them in as they add up.
+func TestUncles_DefaultRewards(t *testing.T) {
+	p := DefaultParams()
+	if got := p.nephewReward(); got == 0 || got*32 != p.blockReward() {
+		t.Errorf("nephew reward %d want %d/32", got, p.blockReward())
+	}
+	nephew := &Block{i: 10}
+	for depth := int64(1); depth <= uncleDepthMax; depth++ {
+		if got := p.uncleReward(&Block{i: nephew.i - depth}, nephew); got*8 != p.blockReward()*(8-depth) {
+			t.Errorf("depth %d: uncle reward %d want %d*%d/8", depth, got, p.blockReward(), 8-depth)
+		}
+	}
+
+	sim := NewSimulation(p)
+	m := newTestMiner(t, sim, "00000a")
+	for i := 0; i < 32; i++ {
+		m.reward(p.nephewReward())
+	}
+	if m.Balance != p.BlockReward || m.rewardCarry != 0 {
+		t.Errorf("32 nephew rewards: balance %d carry %d want %d 0", m.Balance, m.rewardCarry, p.BlockReward)
+	}
+	m.reward(-p.nephewReward())
+	if m.Balance != p.BlockReward-1 || m.rewardCarry != rewardSubunits-p.nephewReward() {
+		t.Errorf("one reorged out: balance %d carry %d", m.Balance, m.rewardCarry)
+	}
+}